@@ -0,0 +1,185 @@
+package bigkeys
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	migrate_slots "github.com/geesugar/redis-tools/migrate-slots"
+	"github.com/geesugar/redis-tools/output"
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/spf13/cobra"
+)
+
+// scanBatch is the number of keys measured in one pipeline
+const scanBatch = 1000
+
+var (
+	addr   string
+	top    int
+	limit  int64
+	format string
+)
+
+func NewBigKeysCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bigkeys",
+		Short: "list the largest keys of the cluster by MEMORY USAGE, with their slot and master",
+		Run:   Run,
+	}
+
+	cmd.Flags().StringVarP(&addr, "addr", "", "", "redis addr")
+	cmd.Flags().IntVarP(&top, "top", "", 20, "number of keys listed, the largest first, 0 lists them all")
+	cmd.Flags().Int64VarP(&limit, "limit", "", 0, "keys scanned per master, 0 scans every key")
+	output.AddFlag(cmd.Flags(), &format)
+
+	return cmd
+}
+
+type Report struct {
+	Scanned int64    `json:"scanned"`
+	Keys    []BigKey `json:"keys"`
+}
+
+type BigKey struct {
+	rh.KeySize
+	Slot   int    `json:"slot"`
+	NodeID string `json:"node_id"`
+	Addr   string `json:"addr"`
+}
+
+func Run(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+
+	nodes, err := rh.GetClusterNodes(ctx, addr, conn_options.Options)
+	if err != nil {
+		log.Fatalf("GetClusterNodes error: %s", err)
+	}
+
+	masterCliMap, err := migrate_slots.NewMasterClients(ctx, nodes)
+	if err != nil {
+		log.Fatalf("new master clients error: %s", err)
+	}
+	defer migrate_slots.CloseClients(masterCliMap)
+
+	report, err := FindBigKeys(ctx, masterCliMap, nodes, top, limit)
+	if err != nil {
+		log.Fatalf("find big keys error: %s", err)
+	}
+
+	if err := output.Print(format, report, report.PrintTable); err != nil {
+		log.Fatalf("print report error: %s", err)
+	}
+}
+
+// FindBigKeys scans up to limit keys of every master, 0 scans them all, and returns the top largest, 0 returns them all
+func FindBigKeys(ctx context.Context, masterCliMap map[string]*rh.Client, nodes []*rh.ClusterNode, top int, limit int64) (*Report, error) {
+	report := &Report{}
+	keys := &bigKeyHeap{}
+	var seq int64
+
+	// keep adds sizes to keys, dropping the smallest key once there are more than top
+	keep := func(node *rh.ClusterNode, sizes []rh.KeySize) {
+		for _, size := range sizes {
+			if size.Type == "none" {
+				continue
+			}
+
+			key := BigKey{KeySize: size, Slot: rh.KeySlot([]byte(size.Key)), NodeID: node.ID, Addr: node.Addr}
+			seq++
+			heap.Push(keys, seqBigKey{BigKey: key, seq: seq})
+			if top > 0 && keys.Len() > top {
+				heap.Pop(keys)
+			}
+		}
+	}
+
+	for _, node := range nodes {
+		if !node.IsMaster() {
+			continue
+		}
+
+		cli, ok := masterCliMap[node.Addr]
+		if !ok {
+			return nil, fmt.Errorf("master addr not found. addr:%s", node.Addr)
+		}
+
+		var batch []string
+		measure := func() error {
+			sizes, err := cli.KeySizes(ctx, batch, true)
+			if err != nil {
+				return err
+			}
+			keep(node, sizes)
+			batch = batch[:0]
+			return nil
+		}
+
+		err := cli.ScanKeys(ctx, limit, func(key string) error {
+			report.Scanned++
+			batch = append(batch, key)
+			if len(batch) < scanBatch {
+				return nil
+			}
+			return measure()
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(batch) > 0 {
+			if err := measure(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// the largest first, the first scanned first among keys of the same size
+	sort.Slice(*keys, func(i, j int) bool { return keys.Less(j, i) })
+	for _, key := range *keys {
+		report.Keys = append(report.Keys, key.BigKey)
+	}
+
+	return report, nil
+}
+
+// seqBigKey orders the keys of the same size by seq, the order they were measured in
+type seqBigKey struct {
+	BigKey
+	seq int64
+}
+
+// bigKeyHeap is a min-heap of keys by size, the last scanned being the smallest among keys of the same size
+type bigKeyHeap []seqBigKey
+
+func (h bigKeyHeap) Len() int { return len(h) }
+
+func (h bigKeyHeap) Less(i, j int) bool {
+	if h[i].Bytes != h[j].Bytes {
+		return h[i].Bytes < h[j].Bytes
+	}
+	return h[i].seq > h[j].seq
+}
+
+func (h bigKeyHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *bigKeyHeap) Push(x any) { *h = append(*h, x.(seqBigKey)) }
+
+func (h *bigKeyHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func (r *Report) PrintTable(w io.Writer) {
+	fmt.Fprintf(w, "scanned:%d\n", r.Scanned)
+	fmt.Fprintf(w, "KEY\tTYPE\tBYTES\tLENGTH\tSLOT\tNODE_ID\tADDR\n")
+	for _, key := range r.Keys {
+		fmt.Fprintf(w, "%q\t%s\t%d\t%d\t%d\t%s\t%s\n", key.Key, key.Type, key.Bytes, key.Length, key.Slot, key.NodeID, key.Addr)
+	}
+}
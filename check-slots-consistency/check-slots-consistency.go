@@ -1,66 +1,186 @@
 package check_slots_consistency
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"sort"
+	"time"
 
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	"github.com/geesugar/redis-tools/output"
 	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
 	"github.com/spf13/cobra"
 )
 
+// ExitInconsistent is the exit code when any view disagrees, errors exit with 1
+const ExitInconsistent = 2
+
 var (
-	addr string
+	addr            string
+	format          string
+	includeReplicas bool
+	timeout         time.Duration
 )
 
 func NewCheckSlotsConsistencyCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use: "check-slots-consistency",
-		Run: Run,
+		Use:  "check-slots-consistency",
+		Long: fmt.Sprintf("compare the slots of the masters as seen by every master, exit with %d when any view disagrees", ExitInconsistent),
+		Run:  Run,
 	}
 
 	cmd.Flags().StringVarP(&addr, "addr", "", "", "redis addr")
+	cmd.Flags().BoolVarP(&includeReplicas, "include-replicas", "", false, "query every node, replicas and failed nodes included, and compare their views with the majority view")
+	cmd.Flags().DurationVarP(&timeout, "timeout", "", 3*time.Second, "timeout of the connection to each node")
+	output.AddFlag(cmd.Flags(), &format)
 
 	return cmd
 }
 
+// Report is the result of comparing the view of every observer with the view of Origin
+type Report struct {
+	Consistent bool              `json:"consistent"`
+	Origin     string            `json:"origin"`
+	Observers  []*ObserverReport `json:"observers"`
+}
+
+// ObserverReport is the difference between the view of one observer and the view of the origin
+type ObserverReport struct {
+	NodeID     string          `json:"node_id"`
+	Addr       string          `json:"addr"`
+	Consistent bool            `json:"consistent"`
+	Error      string          `json:"error,omitempty"`
+	Mismatches []SlotsMismatch `json:"mismatches,omitempty"`
+}
+
+// SlotsMismatch lists the slots of a master the observer lacks or has in excess compared to the origin
+type SlotsMismatch struct {
+	NodeID  string `json:"node_id"`
+	Missing string `json:"missing,omitempty"`
+	Extra   string `json:"extra,omitempty"`
+}
+
 func Run(cmd *cobra.Command, args []string) {
 	ctx := cmd.Context()
 
-	nodes, err := rh.GetClusterNodes(ctx, addr)
+	opts := *conn_options.Options
+	opts.Timeout = timeout
+
+	var (
+		report consistencyReport
+		err    error
+	)
+	if includeReplicas {
+		report, err = CheckMajorityConsistency(ctx, addr, &opts)
+	} else {
+		report, err = CheckSlotsConsistency(ctx, addr, &opts)
+	}
 	if err != nil {
-		log.Fatalf("GetClusterNodes error: %s", err)
+		log.Fatalf("check slots consistency error: %s", err)
 	}
 
-	masterNodes := make(map[string]*rh.ClusterNode, len(nodes))
+	if err := output.Print(format, report, report.PrintTable); err != nil {
+		log.Fatalf("print report error: %s", err)
+	}
+
+	if !report.IsConsistent() {
+		os.Exit(ExitInconsistent)
+	}
+}
+
+// consistencyReport is the report of either mode of the command
+type consistencyReport interface {
+	IsConsistent() bool
+	PrintTable(w io.Writer)
+}
+
+func CheckSlotsConsistency(ctx context.Context, addr string, opts *rh.ConnOptions) (*Report, error) {
+	nodes, err := rh.GetClusterNodes(ctx, addr, opts)
+	if err != nil {
+		return nil, fmt.Errorf("GetClusterNodes error: %s", err)
+	}
+
+	var masterNodes []*rh.ClusterNode
 	for _, node := range nodes {
 		if node.IsMaster() {
-			masterNodes[node.ID] = node
+			masterNodes = append(masterNodes, node)
 		}
 	}
 
 	if len(masterNodes) == 0 {
-		log.Fatalf("no master node")
+		return nil, fmt.Errorf("no master node")
 	}
 
+	sort.Slice(masterNodes, func(i, j int) bool { return masterNodes[i].ID < masterNodes[j].ID })
+
+	report := &Report{Consistent: true}
+
 	var originNodes []*rh.ClusterNode
-	var origiNodeAddr string
 	for _, node := range masterNodes {
-		nodes, err := rh.GetClusterNodes(ctx, node.Addr)
+		observer := &ObserverReport{NodeID: node.ID, Addr: node.Addr, Consistent: true}
+		report.Observers = append(report.Observers, observer)
+
+		nodes, err := rh.GetClusterNodes(ctx, node.Addr, opts)
 		if err != nil {
-			log.Fatalf("get cluster nodes of node:%s node_id:%s, err: %s", node.Addr, node.ID, err)
+			observer.Consistent = false
+			observer.Error = fmt.Sprintf("get cluster nodes of node:%s node_id:%s, err: %s", node.Addr, node.ID, err)
+			report.Consistent = false
+			continue
 		}
 
 		if originNodes == nil {
 			originNodes = nodes
-			origiNodeAddr = node.Addr
+			report.Origin = node.ID
 			continue
 		}
 
-		fmt.Printf("compare node_id:%s slots. cur:%s origin:%s\n", node.ID, node.Addr, origiNodeAddr)
-		if err := CompareNodesSlots(nodes, originNodes); err != nil {
-			fmt.Printf("compare nodes slots error: %s\n", err)
+		observer.Mismatches, err = CompareNodesSlots(nodes, originNodes)
+		if err != nil {
+			observer.Error = err.Error()
+		}
+
+		if err != nil || len(observer.Mismatches) > 0 {
+			observer.Consistent = false
+			report.Consistent = false
 		}
 	}
+
+	if originNodes == nil {
+		return nil, fmt.Errorf("no master node answered")
+	}
+
+	return report, nil
+}
+
+func (r *Report) IsConsistent() bool { return r.Consistent }
+
+func (r *Report) PrintTable(w io.Writer) {
+	fmt.Fprintf(w, "OBSERVER\tADDR\tCONSISTENT\tNODE_ID\tMISSING\tEXTRA\tERROR\n")
+	for _, observer := range r.Observers {
+		if len(observer.Mismatches) == 0 {
+			origin := ""
+			if observer.NodeID == r.Origin {
+				origin = "(origin)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%v\t%s\t-\t-\t%s\n", observer.NodeID, observer.Addr, observer.Consistent, origin, dash(observer.Error))
+			continue
+		}
+
+		for _, mismatch := range observer.Mismatches {
+			fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%s\t%s\t%s\n", observer.NodeID, observer.Addr, observer.Consistent,
+				mismatch.NodeID, dash(mismatch.Missing), dash(mismatch.Extra), dash(observer.Error))
+		}
+	}
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
 }
 
 func GetNodeByID(id string, nodes []*rh.ClusterNode) *rh.ClusterNode {
@@ -73,11 +193,13 @@ func GetNodeByID(id string, nodes []*rh.ClusterNode) *rh.ClusterNode {
 	return nil
 }
 
-func CompareNodesSlots(nodes []*rh.ClusterNode, comparedNodes []*rh.ClusterNode) error {
+// CompareNodesSlots returns the masters of nodes whose slots differ from comparedNodes
+func CompareNodesSlots(nodes []*rh.ClusterNode, comparedNodes []*rh.ClusterNode) ([]SlotsMismatch, error) {
 	if len(nodes) != len(comparedNodes) {
-		return fmt.Errorf("nodes count not equal. nodes:%d, comparedNodes:%d", len(nodes), len(comparedNodes))
+		return nil, fmt.Errorf("nodes count not equal. nodes:%d, comparedNodes:%d", len(nodes), len(comparedNodes))
 	}
 
+	var mismatches []SlotsMismatch
 	for _, node := range nodes {
 		if !node.IsMaster() {
 			continue
@@ -85,16 +207,22 @@ func CompareNodesSlots(nodes []*rh.ClusterNode, comparedNodes []*rh.ClusterNode)
 
 		comparedNode := GetNodeByID(node.ID, comparedNodes)
 		if comparedNode == nil {
-			return fmt.Errorf("compared node not found. node_id:%s", node.ID)
+			return nil, fmt.Errorf("compared node not found. node_id:%s", node.ID)
 		}
 
-		equal, str := node.Slots.Compare(comparedNode.Slots)
-		if !equal {
-			fmt.Printf("node_id:%s, slots not equal. %s\n", node.ID, str)
-		} else {
-			fmt.Printf("node_id:%s, slots equal\n", node.ID)
+		missing, extra := node.Slots.Diff(comparedNode.Slots)
+		if missing.IsEmpty() && extra.IsEmpty() {
+			continue
 		}
+
+		mismatches = append(mismatches, SlotsMismatch{
+			NodeID:  node.ID,
+			Missing: missing.String(),
+			Extra:   extra.String(),
+		})
 	}
 
-	return nil
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].NodeID < mismatches[j].NodeID })
+
+	return mismatches, nil
 }
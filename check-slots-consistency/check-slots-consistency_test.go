@@ -0,0 +1,87 @@
+package check_slots_consistency
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+)
+
+const (
+	testID1       = "07c37dfeb235213a872192d90877d0cd55635b91"
+	testID2       = "67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1"
+	testID3       = "e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca"
+	testReplicaID = "a1d1c1f8c8ffb5a1b0e2c3d4e5f60718293a4b5c"
+)
+
+// testNodes parses the CLUSTER NODES lines of three masters owning slots a, b and c, and a replica of the first
+func testNodes(t *testing.T, a, b, c string) []*rh.ClusterNode {
+	t.Helper()
+
+	nodes, err := rh.ParseClusterNodes(strings.Join([]string{
+		testID1 + " 127.0.0.1:30001@31001 master - 0 0 1 connected " + a,
+		testID2 + " 127.0.0.1:30002@31002 master - 0 0 2 connected " + b,
+		testID3 + " 127.0.0.1:30003@31003 master - 0 0 3 connected " + c,
+		testReplicaID + " 127.0.0.1:30004@31004 slave " + testID1 + " 0 0 1 connected",
+	}, "\n"))
+	if err != nil {
+		t.Fatalf("ParseClusterNodes error: %s", err)
+	}
+	return nodes
+}
+
+func TestCompareNodesSlots(t *testing.T) {
+	origin := testNodes(t, "0-5460", "5461-10922", "10923-16383")
+
+	tests := []struct {
+		name       string
+		observed   []*rh.ClusterNode
+		mismatches []SlotsMismatch
+		invalid    bool
+	}{
+		{
+			name:     "same slots",
+			observed: testNodes(t, "0-5460", "5461-10922", "10923-16383"),
+		},
+		{
+			name:     "slot moved",
+			observed: testNodes(t, "0-99 101-5460", "100 5461-10922", "10923-16383"),
+			mismatches: []SlotsMismatch{
+				{NodeID: testID1, Missing: "100"},
+				{NodeID: testID2, Extra: "100"},
+			},
+		},
+		{
+			name:       "slot not served",
+			observed:   testNodes(t, "0-5460", "5461-10922", "10923-16382"),
+			mismatches: []SlotsMismatch{{NodeID: testID3, Missing: "16383"}},
+		},
+		{
+			name:     "node count differs",
+			observed: testNodes(t, "0-5460", "5461-10922", "10923-16383")[:3],
+			invalid:  true,
+		},
+		{
+			name: "node unknown",
+			observed: func() []*rh.ClusterNode {
+				nodes := testNodes(t, "0-5460", "5461-10922", "10923-16383")
+				nodes[2].ID = "f7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca"
+				return nodes
+			}(),
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mismatches, err := CompareNodesSlots(tt.observed, origin)
+			if tt.invalid != (err != nil) {
+				t.Fatalf("CompareNodesSlots error = %v, want error %v", err, tt.invalid)
+			}
+			if !reflect.DeepEqual(mismatches, tt.mismatches) {
+				t.Errorf("CompareNodesSlots = %+v, want %+v", mismatches, tt.mismatches)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package check_slots_consistency
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+)
+
+const (
+	FieldNodes    = "nodes"
+	FieldRole     = "role"
+	FieldMasterID = "master_id"
+	FieldEpoch    = "epoch"
+	FieldSlots    = "slots"
+)
+
+// MajorityReport compares the view of every node, replicas included, with the view shared by most of them
+type MajorityReport struct {
+	Consistent    bool                 `json:"consistent"`
+	Majority      []string             `json:"majority"`
+	Unreachable   []ObserverReport     `json:"unreachable,omitempty"`
+	Disagreements []FieldDisagreements `json:"disagreements,omitempty"`
+}
+
+// FieldDisagreements lists the observers whose view of Field differs from the majority
+type FieldDisagreements struct {
+	Field     string         `json:"field"`
+	Observers []ObserverDiff `json:"observers"`
+}
+
+type ObserverDiff struct {
+	Observer string `json:"observer"`
+	Addr     string `json:"addr"`
+	NodeID   string `json:"node_id"`
+	Value    string `json:"value"`
+	Majority string `json:"majority"`
+}
+
+type observerView struct {
+	node  *rh.ClusterNode
+	view  map[string]*rh.ClusterNode
+	print string
+}
+
+// CheckMajorityConsistency queries every node known to addr, including replicas and failed nodes,
+// and reports the observers disagreeing with the majority view grouped by field.
+func CheckMajorityConsistency(ctx context.Context, addr string, opts *rh.ConnOptions) (*MajorityReport, error) {
+	nodes, err := rh.GetClusterNodes(ctx, addr, opts)
+	if err != nil {
+		return nil, fmt.Errorf("GetClusterNodes error: %s", err)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	var (
+		views       []*observerView
+		unreachable []ObserverReport
+	)
+	for _, node := range nodes {
+		if node.IsNoAddr() {
+			unreachable = append(unreachable, ObserverReport{NodeID: node.ID, Addr: node.Addr, Error: "noaddr"})
+			continue
+		}
+
+		nodes, err := rh.GetClusterNodes(ctx, node.Addr, opts)
+		if err != nil {
+			unreachable = append(unreachable, ObserverReport{NodeID: node.ID, Addr: node.Addr, Error: err.Error()})
+			continue
+		}
+
+		views = append(views, newObserverView(node, nodes))
+	}
+
+	return voteMajority(views, unreachable)
+}
+
+func newObserverView(node *rh.ClusterNode, nodes []*rh.ClusterNode) *observerView {
+	ov := &observerView{node: node, view: make(map[string]*rh.ClusterNode, len(nodes))}
+	for _, n := range nodes {
+		ov.view[n.ID] = n
+	}
+	ov.print = fingerprint(ov.view)
+	return ov
+}
+
+// voteMajority reports the views, sorted by observer ID, disagreeing with the view shared by most of them
+func voteMajority(views []*observerView, unreachable []ObserverReport) (*MajorityReport, error) {
+	if len(views) == 0 {
+		return nil, fmt.Errorf("no node answered")
+	}
+
+	report := &MajorityReport{Unreachable: unreachable}
+
+	groups := make(map[string][]*observerView)
+	for _, ov := range views {
+		groups[ov.print] = append(groups[ov.print], ov)
+	}
+
+	// the largest group wins, ties go to the group of the lowest observer ID since views are sorted
+	var majority []*observerView
+	for _, ov := range views {
+		if len(groups[ov.print]) > len(majority) {
+			majority = groups[ov.print]
+		}
+	}
+
+	for _, ov := range majority {
+		report.Majority = append(report.Majority, ov.node.ID)
+	}
+
+	disagreements := make(map[string][]ObserverDiff)
+	for _, ov := range views {
+		if ov.print == majority[0].print {
+			continue
+		}
+
+		for field, diffs := range diffViews(ov, majority[0].view) {
+			disagreements[field] = append(disagreements[field], diffs...)
+		}
+	}
+
+	for _, field := range []string{FieldNodes, FieldRole, FieldMasterID, FieldEpoch, FieldSlots} {
+		if diffs, ok := disagreements[field]; ok {
+			report.Disagreements = append(report.Disagreements, FieldDisagreements{Field: field, Observers: diffs})
+		}
+	}
+
+	report.Consistent = len(report.Unreachable) == 0 && len(report.Disagreements) == 0
+
+	return report, nil
+}
+
+// fingerprint covers the fields every observer should agree on, leaving out link and failure states
+func fingerprint(view map[string]*rh.ClusterNode) string {
+	lines := make([]string, 0, len(view))
+	for _, node := range view {
+		lines = append(lines, fmt.Sprintf("%s %s %s %d %s", node.ID, node.Role, node.MasterID, node.Epoch, node.SlotsStr))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func diffViews(ov *observerView, majority map[string]*rh.ClusterNode) map[string][]ObserverDiff {
+	diffs := make(map[string][]ObserverDiff)
+	add := func(field, nodeID, value, majority string) {
+		diffs[field] = append(diffs[field], ObserverDiff{
+			Observer: ov.node.ID,
+			Addr:     ov.node.Addr,
+			NodeID:   nodeID,
+			Value:    value,
+			Majority: majority,
+		})
+	}
+
+	ids := make([]string, 0, len(majority)+len(ov.view))
+	for id := range majority {
+		ids = append(ids, id)
+	}
+	for id := range ov.view {
+		if _, ok := majority[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		expected, ok := majority[id]
+		node, seen := ov.view[id]
+
+		switch {
+		case !seen:
+			add(FieldNodes, id, "missing", "known")
+			continue
+		case !ok:
+			add(FieldNodes, id, "known", "missing")
+			continue
+		}
+
+		if node.Role != expected.Role {
+			add(FieldRole, id, node.Role.String(), expected.Role.String())
+		}
+		if node.MasterID != expected.MasterID {
+			add(FieldMasterID, id, node.MasterID, expected.MasterID)
+		}
+		if node.Epoch != expected.Epoch {
+			add(FieldEpoch, id, fmt.Sprint(node.Epoch), fmt.Sprint(expected.Epoch))
+		}
+		if diff := node.Slots.Compare(expected.Slots); !diff.IsEmpty() {
+			add(FieldSlots, id, diff.String(), expected.SlotsStr)
+		}
+	}
+
+	return diffs
+}
+
+func (r *MajorityReport) IsConsistent() bool { return r.Consistent }
+
+func (r *MajorityReport) PrintTable(w io.Writer) {
+	fmt.Fprintf(w, "consistent:%v majority:%d observers\n", r.Consistent, len(r.Majority))
+
+	if len(r.Unreachable) > 0 {
+		fmt.Fprintf(w, "UNREACHABLE\tADDR\tERROR\n")
+		for _, observer := range r.Unreachable {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", observer.NodeID, observer.Addr, observer.Error)
+		}
+	}
+
+	if len(r.Disagreements) > 0 {
+		fmt.Fprintf(w, "FIELD\tOBSERVER\tADDR\tNODE_ID\tVALUE\tMAJORITY\n")
+		for _, field := range r.Disagreements {
+			for _, diff := range field.Observers {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", field.Field, diff.Observer, diff.Addr, diff.NodeID, dash(diff.Value), dash(diff.Majority))
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package check_slots_consistency
+
+import (
+	"reflect"
+	"testing"
+
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+)
+
+func TestVoteMajority(t *testing.T) {
+	balanced := func(t *testing.T) []*rh.ClusterNode { return testNodes(t, "0-5460", "5461-10922", "10923-16383") }
+	moved := func(t *testing.T) []*rh.ClusterNode {
+		return testNodes(t, "0-99 101-5460", "100 5461-10922", "10923-16383")
+	}
+	// observers are sorted by ID like CheckMajorityConsistency sorts them
+	observers := []string{testID1, testID2, testReplicaID, testID3}
+
+	tests := []struct {
+		name string
+		// views are the views of observers, nil for an unreachable one
+		views         []func(t *testing.T) []*rh.ClusterNode
+		majority      []string
+		disagreements []FieldDisagreements
+		consistent    bool
+		invalid       bool
+	}{
+		{
+			name:       "every view agrees",
+			views:      []func(t *testing.T) []*rh.ClusterNode{balanced, balanced, balanced, balanced},
+			majority:   observers,
+			consistent: true,
+		},
+		{
+			name:     "single deviating node",
+			views:    []func(t *testing.T) []*rh.ClusterNode{balanced, balanced, balanced, moved},
+			majority: observers[:3],
+			disagreements: []FieldDisagreements{{Field: FieldSlots, Observers: []ObserverDiff{
+				{Observer: testID3, Addr: "127.0.0.1:30003", NodeID: testID1, Value: "-[100] +[]", Majority: "0-5460"},
+				{Observer: testID3, Addr: "127.0.0.1:30003", NodeID: testID2, Value: "-[] +[100]", Majority: "5461-10922"},
+			}}},
+		},
+		{
+			name:     "tie goes to the lowest observer ID",
+			views:    []func(t *testing.T) []*rh.ClusterNode{moved, balanced, moved, balanced},
+			majority: []string{testID1, testReplicaID},
+			disagreements: []FieldDisagreements{{Field: FieldSlots, Observers: []ObserverDiff{
+				{Observer: testID2, Addr: "127.0.0.1:30002", NodeID: testID1, Value: "-[] +[100]", Majority: "0-99 101-5460"},
+				{Observer: testID2, Addr: "127.0.0.1:30002", NodeID: testID2, Value: "-[100] +[]", Majority: "100 5461-10922"},
+				{Observer: testID3, Addr: "127.0.0.1:30003", NodeID: testID1, Value: "-[] +[100]", Majority: "0-99 101-5460"},
+				{Observer: testID3, Addr: "127.0.0.1:30003", NodeID: testID2, Value: "-[100] +[]", Majority: "100 5461-10922"},
+			}}},
+		},
+		{
+			name: "missing node and other epoch",
+			views: []func(t *testing.T) []*rh.ClusterNode{balanced, balanced, balanced, func(t *testing.T) []*rh.ClusterNode {
+				nodes := balanced(t)
+				nodes[1].Epoch = 4
+				return nodes[:3]
+			}},
+			majority: observers[:3],
+			disagreements: []FieldDisagreements{
+				{Field: FieldNodes, Observers: []ObserverDiff{
+					{Observer: testID3, Addr: "127.0.0.1:30003", NodeID: testReplicaID, Value: "missing", Majority: "known"},
+				}},
+				{Field: FieldEpoch, Observers: []ObserverDiff{
+					{Observer: testID3, Addr: "127.0.0.1:30003", NodeID: testID2, Value: "4", Majority: "2"},
+				}},
+			},
+		},
+		{
+			name:     "unreachable observer",
+			views:    []func(t *testing.T) []*rh.ClusterNode{balanced, nil, balanced, balanced},
+			majority: []string{testID1, testReplicaID, testID3},
+		},
+		{
+			name:    "no observer answered",
+			views:   []func(t *testing.T) []*rh.ClusterNode{nil, nil, nil, nil},
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := balanced(t)
+
+			var (
+				views       []*observerView
+				unreachable []ObserverReport
+			)
+			for i, id := range observers {
+				node := GetNodeByID(id, origin)
+				if tt.views[i] == nil {
+					unreachable = append(unreachable, ObserverReport{NodeID: id, Addr: node.Addr, Error: "timeout"})
+					continue
+				}
+				views = append(views, newObserverView(node, tt.views[i](t)))
+			}
+
+			report, err := voteMajority(views, unreachable)
+			if tt.invalid != (err != nil) {
+				t.Fatalf("voteMajority error = %v, want error %v", err, tt.invalid)
+			}
+			if tt.invalid {
+				return
+			}
+
+			if !reflect.DeepEqual(report.Majority, tt.majority) {
+				t.Errorf("voteMajority majority = %v, want %v", report.Majority, tt.majority)
+			}
+			if !reflect.DeepEqual(report.Disagreements, tt.disagreements) {
+				t.Errorf("voteMajority disagreements =\n%+v\nwant\n%+v", report.Disagreements, tt.disagreements)
+			}
+			if !reflect.DeepEqual(report.Unreachable, unreachable) {
+				t.Errorf("voteMajority unreachable = %+v, want %+v", report.Unreachable, unreachable)
+			}
+			if report.Consistent != tt.consistent {
+				t.Errorf("voteMajority consistent = %v, want %v", report.Consistent, tt.consistent)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	"github.com/geesugar/redis-tools/output"
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/spf13/cobra"
+)
+
+// ExitUnhealthy is the exit code when any check fails, errors exit with 1
+const ExitUnhealthy = 2
+
+const (
+	CheckUnreachable = "unreachable"
+	CheckCoverage    = "coverage"
+	CheckDuplicate   = "duplicate"
+	CheckReplicas    = "replicas"
+	CheckNodeState   = "node_state"
+	CheckEpoch       = "epoch"
+	CheckAgreement   = "agreement"
+)
+
+var (
+	addr     string
+	replicas int
+	format   string
+)
+
+func NewCheckCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "check whether the cluster is healthy",
+		Long: fmt.Sprintf("check slot coverage and ownership, replicas, node flags, config epochs and that every node agrees on the topology, "+
+			"exit with %d when the cluster is not healthy", ExitUnhealthy),
+		Run: Run,
+	}
+
+	cmd.Flags().StringVarP(&addr, "addr", "", "", "redis addr")
+	cmd.Flags().IntVarP(&replicas, "replicas", "", -1, "expected replicas of every master, -1 skips the check")
+	output.AddFlag(cmd.Flags(), &format)
+
+	return cmd
+}
+
+type Report struct {
+	Healthy  bool      `json:"healthy"`
+	Nodes    int       `json:"nodes"`
+	Masters  int       `json:"masters"`
+	Problems []Problem `json:"problems"`
+}
+
+// Problem is one failed check, Observer is the node whose view showed it
+type Problem struct {
+	Check    string `json:"check"`
+	NodeID   string `json:"node_id,omitempty"`
+	Observer string `json:"observer,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (r *Report) addProblem(check, nodeID, observer, format string, args ...interface{}) {
+	r.Healthy = false
+	r.Problems = append(r.Problems, Problem{
+		Check:    check,
+		NodeID:   nodeID,
+		Observer: observer,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func Run(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+
+	report, err := CheckCluster(ctx, addr, replicas)
+	if err != nil {
+		log.Fatalf("check cluster error: %s", err)
+	}
+
+	if err := output.Print(format, report, report.PrintTable); err != nil {
+		log.Fatalf("print report error: %s", err)
+	}
+
+	if !report.Healthy {
+		os.Exit(ExitUnhealthy)
+	}
+}
+
+// CheckCluster checks the cluster seen from addr, and the view of every node against it.
+// expectedReplicas < 0 skips the replicas check.
+func CheckCluster(ctx context.Context, addr string, expectedReplicas int) (*Report, error) {
+	nodes, err := rh.GetClusterNodes(ctx, addr, conn_options.Options)
+	if err != nil {
+		return nil, fmt.Errorf("GetClusterNodes error: %s", err)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	report := &Report{Healthy: true, Nodes: len(nodes)}
+	seed := rh.ExtractMyself(nodes)
+	seedID := ""
+	if seed != nil {
+		seedID = seed.ID
+	}
+
+	checkSlots(report, nodes)
+	checkReplicas(report, nodes, expectedReplicas)
+	checkEpochs(report, nodes)
+	checkNodeStates(report, nodes, seedID)
+
+	for _, node := range nodes {
+		if node.ID == seedID || node.IsNoAddr() {
+			continue
+		}
+
+		view, err := rh.GetClusterNodes(ctx, node.Addr, conn_options.Options)
+		if err != nil {
+			report.addProblem(CheckUnreachable, node.ID, "", "%s", err)
+			continue
+		}
+
+		checkNodeStates(report, view, node.ID)
+		checkAgreement(report, nodes, view, node.ID)
+	}
+
+	return report, nil
+}
+
+// checkSlots checks every slot is owned by exactly one master
+func checkSlots(report *Report, nodes []*rh.ClusterNode) {
+	owners := make([][]string, rh.TotalSlots)
+	for _, node := range nodes {
+		if !node.IsMaster() {
+			continue
+		}
+
+		report.Masters++
+		for slot := 0; slot < rh.TotalSlots; slot++ {
+			if node.Slots.IsSet(slot) {
+				owners[slot] = append(owners[slot], node.ID)
+			}
+		}
+	}
+
+	uncovered := rh.NewSlots()
+	duplicated := make(map[string]rh.Slots)
+	for slot, ids := range owners {
+		switch {
+		case len(ids) == 0:
+			_ = uncovered.Set(slot)
+		case len(ids) > 1:
+			for _, id := range ids {
+				if _, ok := duplicated[id]; !ok {
+					duplicated[id] = rh.NewSlots()
+				}
+				_ = duplicated[id].Set(slot)
+			}
+		}
+	}
+
+	if !uncovered.IsEmpty() {
+		report.addProblem(CheckCoverage, "", "", "%d slots not covered: %s", uncovered.SlotsCount(), uncovered.String())
+	}
+
+	for _, id := range sortedKeys(duplicated) {
+		report.addProblem(CheckDuplicate, id, "", "slots owned by more than one master: %s", duplicated[id].String())
+	}
+}
+
+func checkReplicas(report *Report, nodes []*rh.ClusterNode, expected int) {
+	if expected < 0 {
+		return
+	}
+
+	for _, master := range nodes {
+		if !master.IsMaster() {
+			continue
+		}
+
+		count := 0
+		for _, node := range nodes {
+			if node.IsSlave() && node.MasterID == master.ID {
+				count++
+			}
+		}
+
+		if count != expected {
+			report.addProblem(CheckReplicas, master.ID, "", "%d replicas, expected %d", count, expected)
+		}
+	}
+}
+
+func checkEpochs(report *Report, nodes []*rh.ClusterNode) {
+	epochs := make(map[int64]int)
+	for _, node := range nodes {
+		if node.IsMaster() {
+			epochs[node.Epoch]++
+		}
+	}
+
+	for _, node := range nodes {
+		if node.IsMaster() && epochs[node.Epoch] > 1 {
+			report.addProblem(CheckEpoch, node.ID, "", "config epoch %d shared by %d masters", node.Epoch, epochs[node.Epoch])
+		}
+	}
+}
+
+// checkNodeStates reports the nodes flagged fail, fail?, noaddr or handshake in the view of observer
+func checkNodeStates(report *Report, view []*rh.ClusterNode, observer string) {
+	for _, node := range view {
+		if !node.IsHealthy() {
+			report.addProblem(CheckNodeState, node.ID, observer, "flags %s", node.State)
+		}
+	}
+}
+
+// checkAgreement compares the view of observer with the view of the seed node
+func checkAgreement(report *Report, nodes, view []*rh.ClusterNode, observer string) {
+	for _, node := range nodes {
+		other := getNodeByID(view, node.ID)
+		if other == nil {
+			report.addProblem(CheckAgreement, node.ID, observer, "node unknown to observer")
+			continue
+		}
+
+		if err := node.CheckEqual(other); err != nil {
+			report.addProblem(CheckAgreement, node.ID, observer, "%s", err)
+		}
+	}
+
+	for _, other := range view {
+		if getNodeByID(nodes, other.ID) == nil {
+			report.addProblem(CheckAgreement, other.ID, observer, "node unknown to the seed node")
+		}
+	}
+}
+
+func (r *Report) PrintTable(w io.Writer) {
+	fmt.Fprintf(w, "healthy:%v nodes:%d masters:%d problems:%d\n", r.Healthy, r.Nodes, r.Masters, len(r.Problems))
+	if len(r.Problems) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "CHECK\tNODE_ID\tOBSERVER\tMESSAGE\n")
+	for _, problem := range r.Problems {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", problem.Check, dash(problem.NodeID), dash(problem.Observer), problem.Message)
+	}
+}
+
+func getNodeByID(nodes []*rh.ClusterNode, id string) *rh.ClusterNode {
+	for _, node := range nodes {
+		if node.ID == id {
+			return node
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]rh.Slots) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,95 @@
+package conn_options
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/spf13/pflag"
+)
+
+// PasswordEnv is read when neither --password nor --password-file is set
+const PasswordEnv = "REDIS_PASSWORD"
+
+var (
+	user               string
+	password           string
+	passwordFile       string
+	tlsEnabled         bool
+	caCert             string
+	cert               string
+	key                string
+	insecureSkipVerify bool
+
+	// Options is filled from the flags by Load, before any command runs
+	Options = &rh.ConnOptions{}
+)
+
+// AddFlags binds the connection flags, they are registered once on the root command for every command
+func AddFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&user, "user", "", "", "ACL user")
+	fs.StringVarP(&password, "password", "", "", "password, also read from --password-file or the "+PasswordEnv+" env")
+	fs.StringVarP(&passwordFile, "password-file", "", "", "file containing the password")
+	fs.BoolVarP(&tlsEnabled, "tls", "", false, "connect with TLS")
+	fs.StringVarP(&caCert, "cacert", "", "", "CA certificate file to verify the server, implies --tls")
+	fs.StringVarP(&cert, "cert", "", "", "client certificate file, implies --tls")
+	fs.StringVarP(&key, "key", "", "", "client private key file, implies --tls")
+	fs.BoolVarP(&insecureSkipVerify, "insecure-skip-verify", "", false, "skip the verification of the server certificate, implies --tls")
+}
+
+// Load resolves the password and the TLS config from the flags into Options
+func Load() error {
+	Options.Username = user
+	Options.Password = password
+
+	if Options.Password == "" && passwordFile != "" {
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return fmt.Errorf("read password file: %v", err)
+		}
+		Options.Password = strings.TrimRight(string(data), "\r\n")
+	}
+
+	if Options.Password == "" {
+		Options.Password = os.Getenv(PasswordEnv)
+	}
+
+	if !tlsEnabled && caCert == "" && cert == "" && key == "" && !insecureSkipVerify {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return fmt.Errorf("read cacert: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in cacert %s", caCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cert != "" || key != "" {
+		if cert == "" || key == "" {
+			return fmt.Errorf("--cert and --key must be set together")
+		}
+
+		certificate, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return fmt.Errorf("load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	Options.TLSConfig = tlsConfig
+	return nil
+}
@@ -0,0 +1,188 @@
+package drain_node
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	migrate_slots "github.com/geesugar/redis-tools/migrate-slots"
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/cobra"
+)
+
+var (
+	addr             string
+	nodeID           string
+	forget           bool
+	shutdownReplicas bool
+	yes              bool
+
+	options = migrate_slots.DefaultOptions()
+)
+
+func NewDrainNodeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drain-node",
+		Short: "move every slot of a master to the remaining masters before decommission",
+		Run:   Run,
+	}
+
+	cmd.Flags().StringVarP(&addr, "addr", "", "", "redis addr")
+	cmd.Flags().StringVarP(&nodeID, "node_id", "", "", "id of the master to drain")
+	cmd.Flags().BoolVarP(&forget, "forget", "", false, "once drained, CLUSTER FORGET the node on every other node")
+	cmd.Flags().BoolVarP(&shutdownReplicas, "shutdown-replicas", "", false, "once drained, shut down the replicas of the node")
+	cmd.Flags().BoolVarP(&yes, "yes", "", false, "shut down and forget without asking for confirmation")
+
+	options.AddFlags(cmd.Flags())
+	options.AddPlanFlags(cmd.Flags())
+
+	return cmd
+}
+
+func Run(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+
+	nodes, err := rh.GetClusterNodes(ctx, addr, conn_options.Options)
+	if err != nil {
+		log.Fatalf("GetClusterNodes error: %s", err)
+	}
+
+	replicas := GetReplicas(nodes, nodeID)
+	if forget && len(replicas) > 0 && !shutdownReplicas {
+		log.Fatalf("node has %d replicas, which refuse to forget their master. add --shutdown-replicas", len(replicas))
+	}
+
+	moves, err := rh.PlanDrain(nodes, nodeID)
+	if err != nil {
+		log.Fatalf("plan drain error: %s", err)
+	}
+
+	masterCliMap, err := migrate_slots.NewMasterClients(ctx, nodes)
+	if err != nil {
+		log.Fatalf("new master clients error: %s", err)
+	}
+	defer migrate_slots.CloseClients(masterCliMap)
+
+	if err := migrate_slots.CountPlanKeys(ctx, masterCliMap, moves); err != nil {
+		log.Fatalf("count plan keys error: %s", err)
+	}
+
+	migrate_slots.RunPlan(ctx, masterCliMap, rh.NewMigrationPlan(addr, nodes, moves), nil, options)
+
+	if options.DryRun || (!forget && !shutdownReplicas) {
+		return
+	}
+
+	nodes, err = rh.GetClusterNodes(ctx, addr, conn_options.Options)
+	if err != nil {
+		log.Fatalf("GetClusterNodes error: %s", err)
+	}
+
+	drained := migrate_slots.GetNodeByID(nodes, nodeID)
+	if drained != nil && !drained.Slots.IsEmpty() {
+		log.Fatalf("node still owns slots:%s", drained.Slots.String())
+	}
+
+	replicas = GetReplicas(nodes, nodeID)
+	if shutdownReplicas {
+		fmt.Printf("shut down %d replicas of node:%s\n", len(replicas), nodeID)
+	}
+	if forget {
+		fmt.Printf("forget node:%s on every other node\n", nodeID)
+	}
+	if !yes {
+		// press enter to continue
+		var input string
+		fmt.Printf("press enter to continue...")
+		fmt.Scanln(&input)
+	}
+
+	forgotten := []string{nodeID}
+	if shutdownReplicas {
+		for _, replica := range replicas {
+			if err := ShutdownNode(ctx, replica.Addr); err != nil {
+				log.Fatalf("shutdown replica error. addr:%s, node_id:%s, err:%s", replica.Addr, replica.ID, err)
+			}
+			fmt.Printf("replica shut down. addr:%s node_id:%s\n", replica.Addr, replica.ID)
+
+			forgotten = append(forgotten, replica.ID)
+		}
+	}
+
+	if !forget {
+		return
+	}
+
+	// every node has to forget within 60 seconds, before gossip brings the forgotten nodes back,
+	// so a failing node doesn't stop the others
+	var failed []string
+	for _, node := range nodes {
+		if contains(forgotten, node.ID) {
+			continue
+		}
+
+		cli, err := rh.NewNodeClient(ctx, node, conn_options.Options)
+		if err != nil {
+			fmt.Printf("new client. addr:%s, err:%s\n", node.Addr, err)
+			failed = append(failed, node.ID+" "+node.Addr)
+			continue
+		}
+
+		for _, id := range forgotten {
+			if err := cli.ClusterForget(ctx, id).Err(); err != nil {
+				fmt.Printf("cluster forget. addr:%s, node_id:%s, err:%s\n", node.Addr, id, err)
+				failed = append(failed, node.ID+" "+node.Addr)
+				break
+			}
+		}
+		cli.Close()
+	}
+
+	if len(failed) > 0 {
+		fmt.Printf("nodes which did not forget:\n")
+		for _, node := range failed {
+			fmt.Printf("  %s\n", node)
+		}
+		log.Fatalf("%d nodes did not forget node:%s, run CLUSTER FORGET on them before gossip brings it back", len(failed), nodeID)
+	}
+
+	fmt.Printf("node forgotten. node_id:%s\n", nodeID)
+}
+
+func GetReplicas(nodes []*rh.ClusterNode, masterID string) []*rh.ClusterNode {
+	var replicas []*rh.ClusterNode
+	for _, node := range nodes {
+		if node.IsSlave() && node.MasterID == masterID {
+			replicas = append(replicas, node)
+		}
+	}
+	return replicas
+}
+
+// ShutdownNode shuts down the node at addr without saving, a drained node has nothing to save
+func ShutdownNode(ctx context.Context, addr string) error {
+	cli, err := rh.NewClientWithOptions(ctx, addr, conn_options.Options)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	// the server closes the connection on success, only a reply from redis is a failure
+	err = cli.ShutdownNoSave(ctx).Err()
+	if _, ok := err.(redis.Error); ok {
+		return err
+	}
+
+	return nil
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
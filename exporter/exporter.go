@@ -0,0 +1,187 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/geesugar/redis-tools/check"
+	check_slots_consistency "github.com/geesugar/redis-tools/check-slots-consistency"
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	fix_open_slots "github.com/geesugar/redis-tools/fix-open-slots"
+	migrate_slots "github.com/geesugar/redis-tools/migrate-slots"
+	"github.com/geesugar/redis-tools/pkg/prom/runtimeprom"
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	CheckConsistency = "consistency"
+	CheckOpenSlots   = "open_slots"
+)
+
+// ProblemsUnknown is the value of check_problems, and of slots_is_balance, when the check could not run
+const ProblemsUnknown = -1
+
+// checks are every check reported by check_problems, so the ones passing again go back to 0
+var checks = []string{
+	check.CheckUnreachable,
+	check.CheckCoverage,
+	check.CheckDuplicate,
+	check.CheckReplicas,
+	check.CheckNodeState,
+	check.CheckEpoch,
+	check.CheckAgreement,
+	CheckConsistency,
+	CheckOpenSlots,
+}
+
+var (
+	addr             string
+	metricsAddr      string
+	interval         time.Duration
+	clusterID        string
+	clusterName      string
+	replicas         int
+	balanceThreshold float64
+)
+
+func NewExporterCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exporter",
+		Short: "check the cluster periodically and serve the results as prometheus metrics",
+		Long: "run the checks of the check and check-slots-consistency commands, the slots balance and the open slots every interval, " +
+			"and serve them on /metrics with the redis clients metrics. resource_status of the cluster is 1 when every check passes",
+		Run: Run,
+	}
+
+	cmd.Flags().StringVarP(&addr, "addr", "", "", "redis addr")
+	cmd.Flags().StringVarP(&metricsAddr, "metrics-addr", "", ":9121", "serve the metrics on this addr, under /metrics")
+	cmd.Flags().DurationVarP(&interval, "interval", "", 30*time.Second, "interval between two rounds of checks")
+	cmd.Flags().StringVarP(&clusterID, "cluster-id", "", "", "cluster_id label of the metrics")
+	cmd.Flags().StringVarP(&clusterName, "cluster-name", "", "", "cluster_name label of the metrics")
+	cmd.Flags().IntVarP(&replicas, "replicas", "", -1, "expected replicas of every master, -1 skips the check")
+	cmd.Flags().Float64VarP(&balanceThreshold, "balance-threshold", "", 2, "slots are balanced if every master is within this percent of its expected slots count")
+
+	return cmd
+}
+
+func Run(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(prometheus.Gatherers{metrics.Registry, prometheus.DefaultGatherer}, promhttp.HandlerOpts{}))
+
+	go func() {
+		log.Fatalf("metrics server error: %s", http.ListenAndServe(metricsAddr, mux))
+	}()
+	fmt.Printf("metrics served on http://%s/metrics\n", metricsAddr)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// a hung node must not stall the next rounds
+		roundCtx, cancel := context.WithTimeout(ctx, interval)
+		if err := Collect(roundCtx); err != nil {
+			fmt.Printf("%s collect error: %s\n", time.Now().Format(time.RFC3339), err)
+		}
+		cancel()
+
+		<-ticker.C
+	}
+}
+
+// Collect runs every check once and sets the gauges. A check failing to run sets its problems
+// to ProblemsUnknown and the cluster unhealthy, the other checks still run.
+func Collect(ctx context.Context) error {
+	problems := make(map[string]int, len(checks))
+	var errs []error
+
+	report, err := check.CheckCluster(ctx, addr, replicas)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("check cluster: %s", err))
+		for _, name := range checks {
+			if name != CheckConsistency && name != CheckOpenSlots {
+				problems[name] = ProblemsUnknown
+			}
+		}
+	} else {
+		for _, problem := range report.Problems {
+			problems[problem.Check]++
+		}
+	}
+
+	start := time.Now()
+	consistency, err := check_slots_consistency.CheckSlotsConsistency(ctx, addr, conn_options.Options)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("check slots consistency: %s", err))
+		problems[CheckConsistency] = ProblemsUnknown
+	} else {
+		runtimeprom.SetConsistencyCheckMetrics(clusterID, clusterName, time.Since(start).Seconds())
+		for _, observer := range consistency.Observers {
+			if !observer.Consistent {
+				problems[CheckConsistency]++
+			}
+		}
+	}
+
+	nodes, err := rh.GetClusterNodes(ctx, addr, conn_options.Options)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("GetClusterNodes: %s", err))
+		problems[CheckOpenSlots] = ProblemsUnknown
+		runtimeprom.SetSlotsIsBalanceMetrics(clusterID, clusterName, ProblemsUnknown)
+	} else {
+		if openSlots, err := getOpenSlots(ctx, nodes); err != nil {
+			errs = append(errs, err)
+			problems[CheckOpenSlots] = ProblemsUnknown
+		} else {
+			problems[CheckOpenSlots] = openSlots.SlotsCount()
+			runtimeprom.SetOpenSlotsMetrics(clusterID, clusterName, openSlots.String())
+		}
+
+		// an unhealthy master fails the planning, it is already reported by the node_state check
+		balanced := 0
+		if moves, err := rh.PlanRebalance(nodes, nil, balanceThreshold); err == nil && len(moves) == 0 {
+			balanced = 1
+		}
+		runtimeprom.SetSlotsIsBalanceMetrics(clusterID, clusterName, balanced)
+	}
+
+	healthy := int64(1)
+	for _, name := range checks {
+		runtimeprom.SetCheckProblemsMetrics(clusterID, clusterName, name, problems[name])
+		if problems[name] != 0 {
+			healthy = 0
+		}
+	}
+	runtimeprom.SetResourceGaugeMetrics(clusterID, clusterName, runtimeprom.ResourceCluster, healthy)
+
+	return errors.Join(errs...)
+}
+
+func getOpenSlots(ctx context.Context, nodes []*rh.ClusterNode) (rh.Slots, error) {
+	masterCliMap, err := migrate_slots.NewMasterClients(ctx, nodes)
+	if err != nil {
+		return nil, fmt.Errorf("new master clients: %s", err)
+	}
+	defer migrate_slots.CloseClients(masterCliMap)
+
+	opens, err := fix_open_slots.GetOpenSlots(ctx, masterCliMap, nodes)
+	if err != nil {
+		return nil, fmt.Errorf("get open slots: %s", err)
+	}
+
+	openSlots := rh.NewSlots()
+	for _, open := range opens {
+		_ = openSlots.Set(open.Slot)
+	}
+
+	return openSlots, nil
+}
@@ -0,0 +1,405 @@
+package fix_open_slots
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	migrate_slots "github.com/geesugar/redis-tools/migrate-slots"
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/spf13/cobra"
+)
+
+var (
+	addr   string
+	dryRun bool
+
+	options = migrate_slots.DefaultOptions()
+)
+
+func NewFixOpenSlotsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fix-open-slots",
+		Short: "close every slot left in importing or migrating state",
+		Run:   Run,
+	}
+
+	cmd.Flags().StringVarP(&addr, "addr", "", "", "redis addr")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "", false, "print the open slots and the planned fix without changing anything")
+	options.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+// OpenSlot is a slot in importing or migrating state, as reported by the masters themselves
+type OpenSlot struct {
+	Slot      int
+	Owner     *rh.ClusterNode
+	Migrating []*rh.ClusterNode
+	Importing []*rh.ClusterNode
+	// MigratingTo is the destination node ID recorded by the migrating node
+	MigratingTo string
+	// ImportingFrom is the source node ID recorded by the importing node
+	ImportingFrom string
+}
+
+func Run(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+
+	nodes, err := rh.GetClusterNodes(ctx, addr, conn_options.Options)
+	if err != nil {
+		log.Fatalf("GetClusterNodes error: %s", err)
+	}
+
+	masterCliMap, err := migrate_slots.NewMasterClients(ctx, nodes)
+	if err != nil {
+		log.Fatalf("new master clients error: %s", err)
+	}
+	defer migrate_slots.CloseClients(masterCliMap)
+
+	openSlots, err := GetOpenSlots(ctx, masterCliMap, nodes)
+	if err != nil {
+		log.Fatalf("get open slots error: %s", err)
+	}
+
+	if len(openSlots) == 0 {
+		fmt.Printf("no open slots\n")
+		return
+	}
+
+	fixer := NewClusterSlotFixer(masterCliMap)
+
+	failed := 0
+	for _, open := range openSlots {
+		fmt.Printf("open slot:%d owner:%s migrating:%s importing:%s\n", open.Slot, nodeID(open.Owner), nodeIDs(open.Migrating), nodeIDs(open.Importing))
+
+		if err := FixOpenSlot(ctx, fixer, nodes, open); err != nil {
+			fmt.Printf("fix open slot error. slot:%d, err:%s\n", open.Slot, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d of %d open slots not fixed", failed, len(openSlots))
+	}
+}
+
+// GetOpenSlots asks every master for its own importing and migrating slots,
+// the markers are only present on the myself line of CLUSTER NODES.
+func GetOpenSlots(ctx context.Context, masterCliMap map[string]*rh.Client, nodes []*rh.ClusterNode) ([]*OpenSlot, error) {
+	openSlotMap := make(map[int]*OpenSlot)
+	getOpenSlot := func(slot int) *OpenSlot {
+		open, ok := openSlotMap[slot]
+		if !ok {
+			open = &OpenSlot{Slot: slot, Owner: getSlotOwner(nodes, slot)}
+			openSlotMap[slot] = open
+		}
+		return open
+	}
+
+	for _, node := range nodes {
+		if !node.IsMaster() {
+			continue
+		}
+
+		cli, ok := masterCliMap[node.Addr]
+		if !ok {
+			return nil, fmt.Errorf("addr not found. addr:%s", node.Addr)
+		}
+
+		view, err := cli.GetClusterNodes(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get cluster nodes. addr:%s, err:%s", node.Addr, err)
+		}
+
+		myself := rh.ExtractMyself(view)
+		if myself == nil {
+			return nil, fmt.Errorf("myself not found. addr:%s", node.Addr)
+		}
+
+		for slot := range myself.Migrating {
+			open := getOpenSlot(slot)
+			open.Migrating = append(open.Migrating, node)
+			open.MigratingTo = myself.Migrating[slot]
+		}
+
+		for slot := range myself.Importing {
+			open := getOpenSlot(slot)
+			open.Importing = append(open.Importing, node)
+			open.ImportingFrom = myself.Importing[slot]
+		}
+	}
+
+	openSlots := make([]*OpenSlot, 0, len(openSlotMap))
+	for _, open := range openSlotMap {
+		openSlots = append(openSlots, open)
+	}
+	sort.Slice(openSlots, func(i, j int) bool { return openSlots[i].Slot < openSlots[j].Slot })
+
+	return openSlots, nil
+}
+
+// SlotFixer runs the commands closing open slots, see ClusterSlotFixer
+type SlotFixer interface {
+	CountKeysInSlot(ctx context.Context, node *rh.ClusterNode, slot int) (int64, error)
+	SetStable(ctx context.Context, node *rh.ClusterNode, slot int) error
+	// AssignSlot assigns slot to node with CLUSTER SETSLOT <slot> NODE on node itself
+	AssignSlot(ctx context.Context, node *rh.ClusterNode, slot int) error
+	MigrateKeys(ctx context.Context, move rh.SlotMove) (int, error)
+	FinalizeSlot(ctx context.Context, src, dst *rh.ClusterNode, slot int) error
+}
+
+// FixOpenSlot closes open.Slot:
+//   - migrating and importing: finish the migration if the destination already has keys, otherwise set both STABLE
+//   - migrating only: set STABLE if the migration target has no keys of the slot
+//   - importing only: move the keys back to the owner and set STABLE, or, when no master owns the slot,
+//     assign it to the importing node holding its keys
+//
+// Anything else, like several nodes importing the same slot, is left to the operator.
+// Nothing is changed with --dry-run.
+func FixOpenSlot(ctx context.Context, fixer SlotFixer, nodes []*rh.ClusterNode, open *OpenSlot) error {
+	if len(open.Migrating) > 1 || len(open.Importing) > 1 {
+		return fmt.Errorf("more than one node migrating or importing, fix it manually")
+	}
+
+	switch {
+	case len(open.Migrating) == 1 && len(open.Importing) == 1:
+		src, dst := open.Migrating[0], open.Importing[0]
+
+		// the markers may be stale leftovers of unrelated migrations
+		if open.MigratingTo != dst.ID || open.ImportingFrom != src.ID {
+			return fmt.Errorf("%s migrating to %s but %s importing from %s, fix it manually", src.ID, open.MigratingTo, dst.ID, open.ImportingFrom)
+		}
+		if open.Owner == nil || open.Owner.ID != src.ID {
+			return fmt.Errorf("migrating node %s is not the owner %s, fix it manually", src.ID, nodeID(open.Owner))
+		}
+
+		dstKeys, err := fixer.CountKeysInSlot(ctx, dst, open.Slot)
+		if err != nil {
+			return err
+		}
+
+		if dstKeys == 0 {
+			fmt.Printf("slot:%d no keys on importing node %s, set STABLE on both sides\n", open.Slot, dst.ID)
+			if dryRun {
+				return nil
+			}
+
+			if err := fixer.SetStable(ctx, dst, open.Slot); err != nil {
+				return err
+			}
+			return fixer.SetStable(ctx, src, open.Slot)
+		}
+
+		fmt.Printf("slot:%d keys on importing node %s, finish the migration from %s\n", open.Slot, dst.ID, src.ID)
+		if dryRun {
+			return nil
+		}
+
+		keyCount, err := fixer.MigrateKeys(ctx, rh.SlotMove{
+			Slot:      open.Slot,
+			SrcNodeID: src.ID,
+			SrcAddr:   src.Addr,
+			DstNodeID: dst.ID,
+			DstAddr:   dst.Addr,
+		})
+		if err != nil {
+			return fmt.Errorf("migrate keys. slot:%d, err:%s", open.Slot, err)
+		}
+
+		if err := fixer.FinalizeSlot(ctx, src, dst, open.Slot); err != nil {
+			return err
+		}
+
+		fmt.Printf("slot:%d migration finished. key_count:%d\n", open.Slot, keyCount)
+		return nil
+
+	case len(open.Migrating) == 1:
+		src := open.Migrating[0]
+
+		if open.Owner == nil || open.Owner.ID != src.ID {
+			return fmt.Errorf("migrating node %s is not the owner %s, fix it manually", src.ID, nodeID(open.Owner))
+		}
+
+		// keys may have been moved to the target before it lost its importing state
+		if target := getNodeByID(nodes, open.MigratingTo); target != nil && target.IsMaster() {
+			targetKeys, err := fixer.CountKeysInSlot(ctx, target, open.Slot)
+			if err != nil {
+				return err
+			}
+
+			if targetKeys > 0 {
+				return fmt.Errorf("migration target %s has %d keys of the slot, fix it manually", target.ID, targetKeys)
+			}
+		}
+
+		fmt.Printf("slot:%d no importing node, set STABLE on %s\n", open.Slot, src.ID)
+		if dryRun {
+			return nil
+		}
+		return fixer.SetStable(ctx, src, open.Slot)
+
+	case len(open.Importing) == 1:
+		dst := open.Importing[0]
+
+		switch {
+		case open.Owner == nil:
+			// the importing node may hold the only copy of the keys, assigning the slot covers it again
+			dstKeys, err := fixer.CountKeysInSlot(ctx, dst, open.Slot)
+			if err != nil {
+				return err
+			}
+
+			if dstKeys == 0 {
+				return fmt.Errorf("slot owned by no master and no keys on importing node %s, fix it manually", dst.ID)
+			}
+
+			fmt.Printf("slot:%d owned by no master, assign it to importing node %s holding %d keys\n", open.Slot, dst.ID, dstKeys)
+			if dryRun {
+				return nil
+			}
+
+			if err := fixer.AssignSlot(ctx, dst, open.Slot); err != nil {
+				return err
+			}
+
+		case open.Owner.ID != dst.ID:
+			dstKeys, err := fixer.CountKeysInSlot(ctx, dst, open.Slot)
+			if err != nil {
+				return err
+			}
+
+			if dstKeys > 0 {
+				fmt.Printf("slot:%d move %d keys from importing node %s back to the owner %s\n", open.Slot, dstKeys, dst.ID, open.Owner.ID)
+				if !dryRun {
+					_, err = fixer.MigrateKeys(ctx, rh.SlotMove{
+						Slot:      open.Slot,
+						SrcNodeID: dst.ID,
+						SrcAddr:   dst.Addr,
+						DstNodeID: open.Owner.ID,
+						DstAddr:   open.Owner.Addr,
+					})
+					if err != nil {
+						return fmt.Errorf("migrate keys. slot:%d, err:%s", open.Slot, err)
+					}
+				}
+			}
+		}
+
+		fmt.Printf("slot:%d no migrating node, set STABLE on %s\n", open.Slot, dst.ID)
+		if dryRun {
+			return nil
+		}
+		return fixer.SetStable(ctx, dst, open.Slot)
+	}
+
+	return nil
+}
+
+// ClusterSlotFixer runs the commands of FixOpenSlot on the masters of the cluster
+type ClusterSlotFixer struct {
+	masterCliMap map[string]*rh.Client
+	migrator     *migrate_slots.Migrator
+}
+
+func NewClusterSlotFixer(masterCliMap map[string]*rh.Client) *ClusterSlotFixer {
+	return &ClusterSlotFixer{
+		masterCliMap: masterCliMap,
+		migrator:     migrate_slots.NewMigrator(masterCliMap, nil, options),
+	}
+}
+
+func (f *ClusterSlotFixer) client(node *rh.ClusterNode) (*rh.Client, error) {
+	cli, ok := f.masterCliMap[node.Addr]
+	if !ok {
+		return nil, fmt.Errorf("addr not found. addr:%s", node.Addr)
+	}
+	return cli, nil
+}
+
+func (f *ClusterSlotFixer) CountKeysInSlot(ctx context.Context, node *rh.ClusterNode, slot int) (int64, error) {
+	cli, err := f.client(node)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := cli.ClusterCountKeysInSlot(ctx, slot).Result()
+	if err != nil {
+		return 0, fmt.Errorf("cluster count keys in slot. addr:%s, slot:%d, err:%s", node.Addr, slot, err)
+	}
+
+	return count, nil
+}
+
+func (f *ClusterSlotFixer) SetStable(ctx context.Context, node *rh.ClusterNode, slot int) error {
+	cli, err := f.client(node)
+	if err != nil {
+		return err
+	}
+
+	if err := cli.ClusterSetSlot(ctx, slot, "STABLE", ""); err != nil {
+		return fmt.Errorf("cluster set slot STABLE. addr:%s, slot:%d, err:%s", node.Addr, slot, err)
+	}
+
+	return nil
+}
+
+func (f *ClusterSlotFixer) AssignSlot(ctx context.Context, node *rh.ClusterNode, slot int) error {
+	cli, err := f.client(node)
+	if err != nil {
+		return err
+	}
+
+	if err := cli.ClusterSetSlot(ctx, slot, "NODE", node.ID); err != nil {
+		return fmt.Errorf("cluster set slot NODE. addr:%s, slot:%d, err:%s", node.Addr, slot, err)
+	}
+
+	return nil
+}
+
+func (f *ClusterSlotFixer) MigrateKeys(ctx context.Context, move rh.SlotMove) (int, error) {
+	return f.migrator.MigrateKeys(ctx, move)
+}
+
+func (f *ClusterSlotFixer) FinalizeSlot(ctx context.Context, src, dst *rh.ClusterNode, slot int) error {
+	return migrate_slots.FinalizeSlot(ctx, f.masterCliMap, src.Addr, dst.Addr, dst.ID, slot)
+}
+
+func getSlotOwner(nodes []*rh.ClusterNode, slot int) *rh.ClusterNode {
+	for _, node := range nodes {
+		if node.IsMaster() && node.Slots.IsSet(slot) {
+			return node
+		}
+	}
+	return nil
+}
+
+func getNodeByID(nodes []*rh.ClusterNode, id string) *rh.ClusterNode {
+	for _, node := range nodes {
+		if node.ID == id {
+			return node
+		}
+	}
+	return nil
+}
+
+func nodeID(node *rh.ClusterNode) string {
+	if node == nil {
+		return "-"
+	}
+	return node.ID
+}
+
+func nodeIDs(nodes []*rh.ClusterNode) string {
+	if len(nodes) == 0 {
+		return "-"
+	}
+
+	s := nodes[0].ID
+	for _, node := range nodes[1:] {
+		s += "," + node.ID
+	}
+	return s
+}
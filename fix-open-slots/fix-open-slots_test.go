@@ -0,0 +1,199 @@
+package fix_open_slots
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+)
+
+// fakeFixer records the commands of FixOpenSlot, keys maps node ID to its key count of the slot
+type fakeFixer struct {
+	keys     map[string]int64
+	countErr error
+	actions  []string
+}
+
+func (f *fakeFixer) CountKeysInSlot(ctx context.Context, node *rh.ClusterNode, slot int) (int64, error) {
+	return f.keys[node.ID], f.countErr
+}
+
+func (f *fakeFixer) SetStable(ctx context.Context, node *rh.ClusterNode, slot int) error {
+	f.actions = append(f.actions, fmt.Sprintf("stable %s %d", node.ID, slot))
+	return nil
+}
+
+func (f *fakeFixer) AssignSlot(ctx context.Context, node *rh.ClusterNode, slot int) error {
+	f.actions = append(f.actions, fmt.Sprintf("assign %s %d", node.ID, slot))
+	return nil
+}
+
+func (f *fakeFixer) MigrateKeys(ctx context.Context, move rh.SlotMove) (int, error) {
+	f.actions = append(f.actions, fmt.Sprintf("migrate %s->%s %d", move.SrcNodeID, move.DstNodeID, move.Slot))
+	return int(f.keys[move.SrcNodeID]), nil
+}
+
+func (f *fakeFixer) FinalizeSlot(ctx context.Context, src, dst *rh.ClusterNode, slot int) error {
+	f.actions = append(f.actions, fmt.Sprintf("finalize %s->%s %d", src.ID, dst.ID, slot))
+	return nil
+}
+
+func TestFixOpenSlot(t *testing.T) {
+	a := &rh.ClusterNode{ID: "a", Addr: "a:6379", Role: rh.RoleMaster}
+	b := &rh.ClusterNode{ID: "b", Addr: "b:6379", Role: rh.RoleMaster}
+	c := &rh.ClusterNode{ID: "c", Addr: "c:6379", Role: rh.RoleMaster}
+	nodes := []*rh.ClusterNode{a, b, c}
+
+	migrating := func(owner, src, dst *rh.ClusterNode) *OpenSlot {
+		return &OpenSlot{Slot: 100, Owner: owner, Migrating: []*rh.ClusterNode{src}, Importing: []*rh.ClusterNode{dst},
+			MigratingTo: dst.ID, ImportingFrom: src.ID}
+	}
+
+	tests := []struct {
+		name     string
+		open     *OpenSlot
+		keys     map[string]int64
+		countErr error
+		dryRun   bool
+		actions  []string
+		invalid  bool
+	}{
+		{
+			name:    "several importing nodes",
+			open:    &OpenSlot{Slot: 100, Owner: a, Importing: []*rh.ClusterNode{b, c}},
+			invalid: true,
+		},
+		{
+			name:    "several migrating nodes",
+			open:    &OpenSlot{Slot: 100, Owner: a, Migrating: []*rh.ClusterNode{a, b}},
+			invalid: true,
+		},
+		{
+			name: "migrating and importing to other nodes",
+			open: &OpenSlot{Slot: 100, Owner: a, Migrating: []*rh.ClusterNode{a}, Importing: []*rh.ClusterNode{b},
+				MigratingTo: "c", ImportingFrom: "a"},
+			invalid: true,
+		},
+		{
+			name: "importing from another node",
+			open: &OpenSlot{Slot: 100, Owner: a, Migrating: []*rh.ClusterNode{a}, Importing: []*rh.ClusterNode{b},
+				MigratingTo: "b", ImportingFrom: "c"},
+			invalid: true,
+		},
+		{
+			name:    "migrating node not the owner",
+			open:    migrating(c, a, b),
+			invalid: true,
+		},
+		{
+			name:    "migrating and importing, no keys on the destination",
+			open:    migrating(a, a, b),
+			keys:    map[string]int64{"a": 10},
+			actions: []string{"stable b 100", "stable a 100"},
+		},
+		{
+			name:    "migrating and importing, keys on the destination",
+			open:    migrating(a, a, b),
+			keys:    map[string]int64{"a": 10, "b": 5},
+			actions: []string{"migrate a->b 100", "finalize a->b 100"},
+		},
+		{
+			name:   "migrating and importing, dry run",
+			open:   migrating(a, a, b),
+			keys:   map[string]int64{"b": 5},
+			dryRun: true,
+		},
+		{
+			name:     "count error",
+			open:     migrating(a, a, b),
+			countErr: fmt.Errorf("timeout"),
+			invalid:  true,
+		},
+		{
+			name:    "migrating only, not the owner",
+			open:    &OpenSlot{Slot: 100, Owner: b, Migrating: []*rh.ClusterNode{a}, MigratingTo: "b"},
+			invalid: true,
+		},
+		{
+			name:    "migrating only, keys on the target",
+			open:    &OpenSlot{Slot: 100, Owner: a, Migrating: []*rh.ClusterNode{a}, MigratingTo: "b"},
+			keys:    map[string]int64{"b": 1},
+			invalid: true,
+		},
+		{
+			name:    "migrating only, no keys on the target",
+			open:    &OpenSlot{Slot: 100, Owner: a, Migrating: []*rh.ClusterNode{a}, MigratingTo: "b"},
+			keys:    map[string]int64{"a": 10},
+			actions: []string{"stable a 100"},
+		},
+		{
+			name:    "migrating only, unknown target",
+			open:    &OpenSlot{Slot: 100, Owner: a, Migrating: []*rh.ClusterNode{a}, MigratingTo: "x"},
+			actions: []string{"stable a 100"},
+		},
+		{
+			name:   "migrating only, dry run",
+			open:   &OpenSlot{Slot: 100, Owner: a, Migrating: []*rh.ClusterNode{a}, MigratingTo: "b"},
+			dryRun: true,
+		},
+		{
+			name:    "importing only, keys moved back to the owner",
+			open:    &OpenSlot{Slot: 100, Owner: a, Importing: []*rh.ClusterNode{b}, ImportingFrom: "a"},
+			keys:    map[string]int64{"b": 3},
+			actions: []string{"migrate b->a 100", "stable b 100"},
+		},
+		{
+			name:    "importing only, no keys",
+			open:    &OpenSlot{Slot: 100, Owner: a, Importing: []*rh.ClusterNode{b}, ImportingFrom: "a"},
+			actions: []string{"stable b 100"},
+		},
+		{
+			name:    "importing only, the importing node owns the slot",
+			open:    &OpenSlot{Slot: 100, Owner: b, Importing: []*rh.ClusterNode{b}, ImportingFrom: "a"},
+			keys:    map[string]int64{"b": 3},
+			actions: []string{"stable b 100"},
+		},
+		{
+			name:    "importing only, no owner and keys on the importing node",
+			open:    &OpenSlot{Slot: 100, Importing: []*rh.ClusterNode{b}, ImportingFrom: "a"},
+			keys:    map[string]int64{"b": 3},
+			actions: []string{"assign b 100", "stable b 100"},
+		},
+		{
+			name:    "importing only, no owner and no keys",
+			open:    &OpenSlot{Slot: 100, Importing: []*rh.ClusterNode{b}, ImportingFrom: "a"},
+			invalid: true,
+		},
+		{
+			name:   "importing only, no owner, dry run",
+			open:   &OpenSlot{Slot: 100, Importing: []*rh.ClusterNode{b}, ImportingFrom: "a"},
+			keys:   map[string]int64{"b": 3},
+			dryRun: true,
+		},
+		{
+			name:   "importing only, dry run",
+			open:   &OpenSlot{Slot: 100, Owner: a, Importing: []*rh.ClusterNode{b}, ImportingFrom: "a"},
+			keys:   map[string]int64{"b": 3},
+			dryRun: true,
+		},
+	}
+
+	defer func(v bool) { dryRun = v }(dryRun)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dryRun = tt.dryRun
+			fixer := &fakeFixer{keys: tt.keys, countErr: tt.countErr}
+
+			err := FixOpenSlot(context.Background(), fixer, nodes, tt.open)
+			if tt.invalid != (err != nil) {
+				t.Fatalf("FixOpenSlot error = %v, want error %v", err, tt.invalid)
+			}
+			if !reflect.DeepEqual(fixer.actions, tt.actions) {
+				t.Errorf("FixOpenSlot actions = %q, want %q", fixer.actions, tt.actions)
+			}
+		})
+	}
+}
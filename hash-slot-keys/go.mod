@@ -1,12 +0,0 @@
-module github.com/geesugar/redis-tools/hash-slot-keys
-
-go 1.21.0
-
-require github.com/howeyc/crc16 v0.0.0-20171223171357-2b2a61e366a6
-
-require (
-	github.com/cespare/xxhash/v2 v2.1.2 // indirect
-	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
-	github.com/go-redis/redis v6.15.9+incompatible // indirect
-	github.com/go-redis/redis/v8 v8.11.5 // indirect
-)
@@ -0,0 +1,230 @@
+package key_distribution
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	migrate_slots "github.com/geesugar/redis-tools/migrate-slots"
+	"github.com/geesugar/redis-tools/output"
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/spf13/cobra"
+)
+
+var (
+	addr   string
+	sample int64
+	top    int
+	format string
+)
+
+func NewKeyDistributionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "key-distribution",
+		Short: "report the keys per slot, per master and per hash tag",
+		Long: "count the keys of every slot of every master with CLUSTER COUNTKEYSINSLOT, " +
+			"and with --sample scan keys of every master to count them per hash tag",
+		Run: Run,
+	}
+
+	cmd.Flags().StringVarP(&addr, "addr", "", "", "redis addr")
+	cmd.Flags().Int64VarP(&sample, "sample", "", 0, "keys scanned per master to count hash tags, 0 skips the scan, -1 scans every key")
+	cmd.Flags().IntVarP(&top, "top", "", 20, "slots and hash tags reported, the ones holding the most keys first, 0 reports them all")
+	output.AddFlag(cmd.Flags(), &format)
+
+	return cmd
+}
+
+type Report struct {
+	Keys    int64   `json:"keys"`
+	Masters int     `json:"masters"`
+	Mean    float64 `json:"mean"`
+	// StdDev is the standard deviation of the keys per master
+	StdDev float64     `json:"stddev"`
+	Nodes  []NodeKeys  `json:"nodes"`
+	Slots  []SlotKeys  `json:"slots"`
+	Sample *TagsSample `json:"sample,omitempty"`
+}
+
+type NodeKeys struct {
+	NodeID  string  `json:"node_id"`
+	Addr    string  `json:"addr"`
+	Slots   int     `json:"slots"`
+	Keys    int64   `json:"keys"`
+	Percent float64 `json:"percent"`
+}
+
+type SlotKeys struct {
+	Slot   int    `json:"slot"`
+	NodeID string `json:"node_id"`
+	Keys   int64  `json:"keys"`
+}
+
+// TagsSample counts the scanned keys per hash tag, keys without a hash tag only count as untagged
+type TagsSample struct {
+	Scanned  int64     `json:"scanned"`
+	Untagged int64     `json:"untagged"`
+	Tags     []TagKeys `json:"tags"`
+}
+
+type TagKeys struct {
+	Tag  string `json:"tag"`
+	Slot int    `json:"slot"`
+	Keys int64  `json:"keys"`
+}
+
+func Run(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+
+	nodes, err := rh.GetClusterNodes(ctx, addr, conn_options.Options)
+	if err != nil {
+		log.Fatalf("GetClusterNodes error: %s", err)
+	}
+
+	masterCliMap, err := migrate_slots.NewMasterClients(ctx, nodes)
+	if err != nil {
+		log.Fatalf("new master clients error: %s", err)
+	}
+	defer migrate_slots.CloseClients(masterCliMap)
+
+	report, err := KeyDistribution(ctx, masterCliMap, nodes, sample, top)
+	if err != nil {
+		log.Fatalf("key distribution error: %s", err)
+	}
+
+	if err := output.Print(format, report, report.PrintTable); err != nil {
+		log.Fatalf("print report error: %s", err)
+	}
+}
+
+// KeyDistribution counts the keys of the masters of nodes. sample keys of every master
+// are scanned for the hash tags, 0 skips the scan. top limits the slots and tags reported.
+func KeyDistribution(ctx context.Context, masterCliMap map[string]*rh.Client, nodes []*rh.ClusterNode, sample int64, top int) (*Report, error) {
+	report := &Report{}
+	tagCounts := make(map[string]int64)
+	if sample != 0 {
+		report.Sample = &TagsSample{}
+	}
+
+	for _, node := range nodes {
+		if !node.IsMaster() {
+			continue
+		}
+
+		cli, ok := masterCliMap[node.Addr]
+		if !ok {
+			return nil, fmt.Errorf("master addr not found. addr:%s", node.Addr)
+		}
+
+		counts, err := cli.CountKeysInSlots(ctx, node.Slots)
+		if err != nil {
+			return nil, err
+		}
+
+		nodeKeys := NodeKeys{NodeID: node.ID, Addr: node.Addr, Slots: node.Slots.SlotsCount()}
+		for slot, count := range counts {
+			nodeKeys.Keys += count
+			if count > 0 {
+				report.Slots = append(report.Slots, SlotKeys{Slot: slot, NodeID: node.ID, Keys: count})
+			}
+		}
+
+		report.Masters++
+		report.Keys += nodeKeys.Keys
+		report.Nodes = append(report.Nodes, nodeKeys)
+
+		if report.Sample == nil {
+			continue
+		}
+
+		err = cli.ScanKeys(ctx, sample, func(key string) error {
+			report.Sample.Scanned++
+
+			tag := rh.HashTag([]byte(key))
+			if len(tag) == len(key) {
+				report.Sample.Untagged++
+				return nil
+			}
+			tagCounts[string(tag)]++
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if report.Masters == 0 {
+		return nil, fmt.Errorf("no master node")
+	}
+
+	report.Mean = float64(report.Keys) / float64(report.Masters)
+	var variance float64
+	for i := range report.Nodes {
+		nodeKeys := &report.Nodes[i]
+		if report.Keys > 0 {
+			nodeKeys.Percent = float64(nodeKeys.Keys) * 100 / float64(report.Keys)
+		}
+		variance += (float64(nodeKeys.Keys) - report.Mean) * (float64(nodeKeys.Keys) - report.Mean)
+	}
+	report.StdDev = math.Sqrt(variance / float64(report.Masters))
+
+	sort.Slice(report.Nodes, func(i, j int) bool { return report.Nodes[i].Keys > report.Nodes[j].Keys })
+
+	sort.Slice(report.Slots, func(i, j int) bool {
+		if report.Slots[i].Keys != report.Slots[j].Keys {
+			return report.Slots[i].Keys > report.Slots[j].Keys
+		}
+		return report.Slots[i].Slot < report.Slots[j].Slot
+	})
+	if top > 0 && len(report.Slots) > top {
+		report.Slots = report.Slots[:top]
+	}
+
+	if report.Sample != nil {
+		for tag, count := range tagCounts {
+			report.Sample.Tags = append(report.Sample.Tags, TagKeys{Tag: tag, Slot: rh.KeySlot([]byte(tag)), Keys: count})
+		}
+
+		sort.Slice(report.Sample.Tags, func(i, j int) bool {
+			if report.Sample.Tags[i].Keys != report.Sample.Tags[j].Keys {
+				return report.Sample.Tags[i].Keys > report.Sample.Tags[j].Keys
+			}
+			return report.Sample.Tags[i].Tag < report.Sample.Tags[j].Tag
+		})
+		if top > 0 && len(report.Sample.Tags) > top {
+			report.Sample.Tags = report.Sample.Tags[:top]
+		}
+	}
+
+	return report, nil
+}
+
+func (r *Report) PrintTable(w io.Writer) {
+	fmt.Fprintf(w, "keys:%d masters:%d mean:%.1f stddev:%.1f\n", r.Keys, r.Masters, r.Mean, r.StdDev)
+
+	fmt.Fprintf(w, "NODE_ID\tADDR\tSLOTS\tKEYS\tPERCENT\n")
+	for _, node := range r.Nodes {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.2f%%\n", node.NodeID, node.Addr, node.Slots, node.Keys, node.Percent)
+	}
+
+	if len(r.Slots) > 0 {
+		fmt.Fprintf(w, "\nSLOT\tNODE_ID\tKEYS\n")
+		for _, slot := range r.Slots {
+			fmt.Fprintf(w, "%d\t%s\t%d\n", slot.Slot, slot.NodeID, slot.Keys)
+		}
+	}
+
+	if r.Sample != nil {
+		fmt.Fprintf(w, "\nscanned:%d untagged:%d\n", r.Sample.Scanned, r.Sample.Untagged)
+		if len(r.Sample.Tags) > 0 {
+			fmt.Fprintf(w, "TAG\tSLOT\tKEYS\n")
+			for _, tag := range r.Sample.Tags {
+				fmt.Fprintf(w, "%s\t%d\t%d\n", tag.Tag, tag.Slot, tag.Keys)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package keyslot
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/spf13/cobra"
+)
+
+var (
+	addr string
+)
+
+func NewKeySlotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keyslot [key...]",
+		Short: "print the hash slot of keys, read from args or one per line from stdin",
+		Run:   Run,
+	}
+
+	cmd.Flags().StringVarP(&addr, "addr", "", "", "optional redis addr, to also print the master owning the slot")
+
+	return cmd
+}
+
+func Run(cmd *cobra.Command, args []string) {
+	var nodes []*rh.ClusterNode
+	if addr != "" {
+		var err error
+		nodes, err = rh.GetClusterNodes(context.Background(), addr, conn_options.Options)
+		if err != nil {
+			log.Fatalf("GetClusterNodes error: %s", err)
+		}
+	}
+
+	printSlot := func(key []byte) {
+		slot := rh.KeySlot(key)
+		if nodes == nil {
+			fmt.Printf("%d\t%s\n", slot, key)
+			return
+		}
+
+		owner := "-\t-"
+		for _, node := range nodes {
+			if node.IsMaster() && node.Slots.IsSet(slot) {
+				owner = node.ID + "\t" + node.Addr
+				break
+			}
+		}
+		fmt.Printf("%d\t%s\t%s\n", slot, owner, key)
+	}
+
+	if len(args) > 0 {
+		for _, key := range args {
+			printSlot([]byte(key))
+		}
+		return
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 512*1024*1024)
+	for scanner.Scan() {
+		printSlot(scanner.Bytes())
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("read stdin error: %s", err)
+	}
+}
@@ -1,8 +1,20 @@
 package main
 
 import (
+	"github.com/geesugar/redis-tools/bigkeys"
+	"github.com/geesugar/redis-tools/check"
 	check_slots_consistency "github.com/geesugar/redis-tools/check-slots-consistency"
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	drain_node "github.com/geesugar/redis-tools/drain-node"
+	"github.com/geesugar/redis-tools/exporter"
+	fix_open_slots "github.com/geesugar/redis-tools/fix-open-slots"
+	key_distribution "github.com/geesugar/redis-tools/key-distribution"
+	"github.com/geesugar/redis-tools/keyslot"
 	migrate_slots "github.com/geesugar/redis-tools/migrate-slots"
+	"github.com/geesugar/redis-tools/rebalance"
+	restore_slots "github.com/geesugar/redis-tools/restore-slots"
+	slot_tags "github.com/geesugar/redis-tools/slot-tags"
+	"github.com/geesugar/redis-tools/snapshot"
 	"github.com/spf13/cobra"
 )
 
@@ -12,10 +24,27 @@ func main() {
 		Run: func(cmd *cobra.Command, args []string) {
 			// Do Stuff Here
 		},
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return conn_options.Load()
+		},
 	}
 
+	conn_options.AddFlags(rootCmd.PersistentFlags())
+
 	rootCmd.AddCommand(migrate_slots.NewMigrationSlotsCmd())
 	rootCmd.AddCommand(check_slots_consistency.NewCheckSlotsConsistencyCmd())
+	rootCmd.AddCommand(fix_open_slots.NewFixOpenSlotsCmd())
+	rootCmd.AddCommand(rebalance.NewRebalanceCmd())
+	rootCmd.AddCommand(drain_node.NewDrainNodeCmd())
+	rootCmd.AddCommand(check.NewCheckCmd())
+	rootCmd.AddCommand(keyslot.NewKeySlotCmd())
+	rootCmd.AddCommand(slot_tags.NewSlotTagsCmd())
+	rootCmd.AddCommand(key_distribution.NewKeyDistributionCmd())
+	rootCmd.AddCommand(bigkeys.NewBigKeysCmd())
+	rootCmd.AddCommand(exporter.NewExporterCmd())
+	rootCmd.AddCommand(snapshot.NewSnapshotCmd())
+	rootCmd.AddCommand(snapshot.NewDiffCmd())
+	rootCmd.AddCommand(restore_slots.NewRestoreSlotsCmd())
 
 	rootCmd.Execute()
 }
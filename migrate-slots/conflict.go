@@ -0,0 +1,149 @@
+package migrate_slots
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ConflictPolicyFail stops the migration of the slot on the first key failing to migrate
+	ConflictPolicyFail = "fail"
+	// ConflictPolicyReplace migrates again with REPLACE the keys already existing on the destination
+	ConflictPolicyReplace = "replace"
+	// ConflictPolicySkipAndReport leaves the failing keys on the source, the slot is left open
+	ConflictPolicySkipAndReport = "skip-and-report"
+)
+
+const (
+	ResolutionReplaced = "replaced"
+	ResolutionSkipped  = "skipped"
+	ResolutionFailed   = "failed"
+)
+
+// ProblemKey is a key which failed to migrate on its own, and what was done about it
+type ProblemKey struct {
+	Slot       int
+	Key        string
+	Error      string
+	Resolution string
+}
+
+// SkippedKeysError is returned for a slot left open because some of its keys were skipped,
+// see ConflictPolicySkipAndReport
+type SkippedKeysError struct {
+	Slot int
+	Keys int
+}
+
+func (e *SkippedKeysError) Error() string {
+	return fmt.Sprintf("slot %d left open, %d keys skipped", e.Slot, e.Keys)
+}
+
+func isBusyKey(err error) bool {
+	return strings.Contains(err.Error(), "BUSYKEY")
+}
+
+// isKeyError tells whether the MIGRATE error is caused by one of its keys, like a key existing on the destination
+// or a payload it refuses. Network errors, timeouts, IOERR and OOM hit every key alike.
+func isKeyError(err error) bool {
+	if isBusyKey(err) {
+		return true
+	}
+
+	// RESTORE errors of the destination are relayed as is
+	return strings.HasPrefix(err.Error(), "ERR Target instance replied with error") && !strings.Contains(err.Error(), "OOM")
+}
+
+// migrateFunc sends a single MIGRATE of keys, with REPLACE if replace is set
+type migrateFunc func(keys []string, replace bool) error
+
+// migrateBatch migrates keys, a MIGRATE failing because of a key is split in halves until the keys failing
+// on their own are isolated and handled by the conflict policy. Keys already moved by a failed MIGRATE are gone
+// from the source, so migrating them again is a no-op. Errors not caused by a key are returned at once.
+// It returns the keys skipped.
+func (m *Migrator) migrateBatch(slot int, keys []string, migrate migrateFunc) ([]string, error) {
+	err := migrate(keys, m.opts.Replace)
+	if err == nil {
+		return nil, nil
+	}
+
+	if !isKeyError(err) {
+		return nil, err
+	}
+
+	if len(keys) > 1 {
+		half := len(keys) / 2
+		skipped, err := m.migrateBatch(slot, keys[:half], migrate)
+		if err != nil {
+			return nil, err
+		}
+
+		more, err := m.migrateBatch(slot, keys[half:], migrate)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(skipped, more...), nil
+	}
+
+	problem := ProblemKey{Slot: slot, Key: keys[0], Error: err.Error()}
+	switch m.opts.ConflictPolicy {
+	case ConflictPolicyFail:
+		problem.Resolution = ResolutionFailed
+		m.addProblem(problem)
+		return nil, fmt.Errorf("migrate key %q: %s", keys[0], err)
+
+	case ConflictPolicyReplace:
+		if !isBusyKey(err) || m.opts.Replace {
+			problem.Resolution = ResolutionFailed
+			m.addProblem(problem)
+			return nil, fmt.Errorf("migrate key %q: %s", keys[0], err)
+		}
+
+		if err := migrate(keys, true); err != nil {
+			problem.Error = err.Error()
+			problem.Resolution = ResolutionFailed
+			m.addProblem(problem)
+			return nil, fmt.Errorf("migrate key %q with REPLACE: %s", keys[0], err)
+		}
+
+		problem.Resolution = ResolutionReplaced
+		m.addProblem(problem)
+		return nil, nil
+
+	case ConflictPolicySkipAndReport:
+		problem.Resolution = ResolutionSkipped
+		m.addProblem(problem)
+		return keys, nil
+	}
+
+	return nil, fmt.Errorf("unknown conflict policy %s", m.opts.ConflictPolicy)
+}
+
+func (m *Migrator) addProblem(problem ProblemKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.problems = append(m.problems, problem)
+}
+
+// Problems returns the keys which failed to migrate on their own so far
+func (m *Migrator) Problems() []ProblemKey {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]ProblemKey(nil), m.problems...)
+}
+
+// PrintProblems prints the report of the keys which failed to migrate on their own
+func (m *Migrator) PrintProblems() {
+	problems := m.Problems()
+	if len(problems) == 0 {
+		return
+	}
+
+	fmt.Printf("problem keys: %d\n", len(problems))
+	for _, problem := range problems {
+		fmt.Printf("slot:%d key:%q resolution:%s err:%s\n", problem.Slot, problem.Key, problem.Resolution, problem.Error)
+	}
+}
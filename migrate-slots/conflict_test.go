@@ -0,0 +1,179 @@
+package migrate_slots
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+const busyKeyError = "ERR Target instance replied with error: BUSYKEY Target key name already exists."
+
+// fakeMigrate migrates keys one by one like MIGRATE does, stopping at the first key of failures
+// unless it is migrated with REPLACE and fails with BUSYKEY. err fails every MIGRATE.
+type fakeMigrate struct {
+	failures map[string]string
+	err      error
+	moved    map[string]bool
+	calls    int
+}
+
+func (f *fakeMigrate) migrate(keys []string, replace bool) error {
+	f.calls++
+	if f.err != nil {
+		return f.err
+	}
+
+	for _, key := range keys {
+		if f.moved[key] {
+			continue
+		}
+		if failure, ok := f.failures[key]; ok && !(replace && failure == busyKeyError) {
+			return errors.New(failure)
+		}
+		f.moved[key] = true
+	}
+	return nil
+}
+
+func TestMigrateBatch(t *testing.T) {
+	keys := []string{"k0", "k1", "k2", "k3", "k4", "k5", "k6", "k7"}
+	badPayload := "ERR Target instance replied with error: ERR DUMP payload version or checksum are wrong"
+
+	tests := []struct {
+		name     string
+		policy   string
+		replace  bool
+		failures map[string]string
+		err      error
+		skipped  []string
+		problems []ProblemKey
+		calls    int
+		invalid  bool
+	}{
+		{
+			name:   "no conflict",
+			policy: ConflictPolicyFail,
+			calls:  1,
+		},
+		{
+			name:     "fail",
+			policy:   ConflictPolicyFail,
+			failures: map[string]string{"k3": busyKeyError},
+			problems: []ProblemKey{{Slot: 1, Key: "k3", Error: busyKeyError, Resolution: ResolutionFailed}},
+			// k0-k7, k0-k3, k0-k1, k2-k3, k2, k3
+			calls:   6,
+			invalid: true,
+		},
+		{
+			name:     "replace",
+			policy:   ConflictPolicyReplace,
+			failures: map[string]string{"k3": busyKeyError},
+			problems: []ProblemKey{{Slot: 1, Key: "k3", Error: busyKeyError, Resolution: ResolutionReplaced}},
+			// the failing ones, k3 with REPLACE and k4-k7
+			calls: 8,
+		},
+		{
+			name:     "replace only busy keys",
+			policy:   ConflictPolicyReplace,
+			failures: map[string]string{"k3": badPayload},
+			problems: []ProblemKey{{Slot: 1, Key: "k3", Error: badPayload, Resolution: ResolutionFailed}},
+			calls:    6,
+			invalid:  true,
+		},
+		{
+			name:     "replace already set",
+			policy:   ConflictPolicyReplace,
+			replace:  true,
+			failures: map[string]string{"k3": badPayload},
+			problems: []ProblemKey{{Slot: 1, Key: "k3", Error: badPayload, Resolution: ResolutionFailed}},
+			calls:    6,
+			invalid:  true,
+		},
+		{
+			name:     "skip and report",
+			policy:   ConflictPolicySkipAndReport,
+			failures: map[string]string{"k1": busyKeyError, "k6": badPayload},
+			skipped:  []string{"k1", "k6"},
+			problems: []ProblemKey{
+				{Slot: 1, Key: "k1", Error: busyKeyError, Resolution: ResolutionSkipped},
+				{Slot: 1, Key: "k6", Error: badPayload, Resolution: ResolutionSkipped},
+			},
+			// k0-k7, k0-k3, k0-k1, k0, k1, k2-k3, k4-k7, k4-k5, k6-k7, k6, k7
+			calls: 11,
+		},
+		{
+			name:    "IOERR is not split",
+			policy:  ConflictPolicySkipAndReport,
+			err:     errors.New("IOERR error or timeout reading to target instance"),
+			calls:   1,
+			invalid: true,
+		},
+		{
+			name:    "network error is not split",
+			policy:  ConflictPolicySkipAndReport,
+			err:     fmt.Errorf("read tcp: %w", io.EOF),
+			calls:   1,
+			invalid: true,
+		},
+		{
+			name:    "OOM of the destination is not split",
+			policy:  ConflictPolicySkipAndReport,
+			err:     errors.New("ERR Target instance replied with error: OOM command not allowed when used memory > 'maxmemory'."),
+			calls:   1,
+			invalid: true,
+		},
+		{
+			name:     "network error after a split",
+			policy:   ConflictPolicySkipAndReport,
+			failures: map[string]string{"k0": busyKeyError, "k4": "IOERR error or timeout writing to target instance"},
+			skipped:  nil,
+			problems: []ProblemKey{{Slot: 1, Key: "k0", Error: busyKeyError, Resolution: ResolutionSkipped}},
+			// k0-k7, k0-k3, k0-k1, k0, k1, k2-k3, k4-k7
+			calls:   7,
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.ConflictPolicy = tt.policy
+			opts.Replace = tt.replace
+			m := NewMigrator(nil, nil, opts)
+
+			fake := &fakeMigrate{failures: tt.failures, err: tt.err, moved: make(map[string]bool)}
+			skipped, err := m.migrateBatch(1, keys, fake.migrate)
+			if tt.invalid != (err != nil) {
+				t.Fatalf("migrateBatch error = %v, want error %v", err, tt.invalid)
+			}
+			if !reflect.DeepEqual(skipped, tt.skipped) {
+				t.Errorf("migrateBatch skipped = %v, want %v", skipped, tt.skipped)
+			}
+			if problems := m.Problems(); !reflect.DeepEqual(problems, tt.problems) {
+				t.Errorf("migrateBatch problems = %+v, want %+v", problems, tt.problems)
+			}
+			if fake.calls != tt.calls {
+				t.Errorf("migrateBatch calls = %d, want %d", fake.calls, tt.calls)
+			}
+
+			if err == nil {
+				for _, key := range keys {
+					if !fake.moved[key] && !contains(tt.skipped, key) {
+						t.Errorf("key %s neither moved nor skipped", key)
+					}
+				}
+			}
+		})
+	}
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,340 @@
+package migrate_slots
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+)
+
+// Step is the last confirmed state transition of a slot migration
+type Step int
+
+const (
+	StepNone Step = iota
+	StepImporting
+	StepMigrating
+	StepKeysMoved
+	StepFinalized
+	// StepVerified follows StepFinalized in the journals of a migration run with --verify
+	StepVerified
+)
+
+var stepNames = []string{"none", "importing", "migrating", "keys_moved", "finalized", "verified"}
+
+func (s Step) String() string {
+	if s < 0 || int(s) >= len(stepNames) {
+		return fmt.Sprintf("step(%d)", int(s))
+	}
+	return stepNames[s]
+}
+
+func (s Step) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Step) UnmarshalText(text []byte) error {
+	for i, name := range stepNames {
+		if name == string(text) {
+			*s = Step(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid step %q", string(text))
+}
+
+// JournalEntry is one line of the journal. The first entry carries the plan,
+// the following ones record the steps of each slot.
+type JournalEntry struct {
+	Time      time.Time         `json:"time"`
+	Plan      *rh.MigrationPlan `json:"plan,omitempty"`
+	Slot      int               `json:"slot"`
+	SrcNodeID string            `json:"src_node_id,omitempty"`
+	DstNodeID string            `json:"dst_node_id,omitempty"`
+	Step      Step              `json:"step"`
+	KeyCount  int               `json:"key_count,omitempty"`
+	// Verify is set on the plan entry if every slot is verified once finalized
+	Verify bool `json:"verify,omitempty"`
+}
+
+// Journal is an append-only file of the state transitions of a migration plan.
+// A nil *Journal records nothing.
+type Journal struct {
+	mu    sync.Mutex
+	f     *os.File
+	plan  *rh.MigrationPlan
+	steps map[int]Step
+	// keyCounts are the keys migrated of each slot, recorded with StepKeysMoved
+	keyCounts map[int]int
+	// verify tells whether the slots are done once verified rather than finalized
+	verify bool
+}
+
+// CreateJournal writes plan as the first entry of a new journal at path. An existing journal is only
+// overwritten if every slot of its plan is done, or if force is set. With verify a slot is done
+// once StepVerified is recorded.
+func CreateJournal(path string, plan *rh.MigrationPlan, verify, force bool) (*Journal, error) {
+	flag := os.O_CREATE | os.O_EXCL | os.O_WRONLY
+	if force {
+		flag = os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	}
+
+	f, err := os.OpenFile(path, flag, 0644)
+	if os.IsExist(err) {
+		if err := CheckJournalFinished(path); err != nil {
+			return nil, err
+		}
+		f, err = os.OpenFile(path, os.O_TRUNC|os.O_WRONLY, 0644)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{
+		f:         f,
+		plan:      plan,
+		steps:     make(map[int]Step, len(plan.Moves)),
+		keyCounts: make(map[int]int),
+		verify:    verify,
+	}
+
+	if err := j.write(&JournalEntry{Time: time.Now(), Plan: plan, Verify: verify}); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// CheckJournalFinished returns an error if the journal at path has slots not done,
+// a missing journal is finished
+func CheckJournalFinished(path string) error {
+	j, err := OpenJournal(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("journal %s exists and can not be read, remove it or pass --force-journal: %s", path, err)
+	}
+	defer j.Close()
+
+	if unfinished := j.Unfinished(); len(unfinished) > 0 {
+		return fmt.Errorf("journal %s has %d slots not done, run migrate-slots --resume --journal %s, or pass --force-journal to overwrite it",
+			path, len(unfinished), path)
+	}
+
+	return nil
+}
+
+// OpenJournal reads the plan and the last step of each slot from path, and reopens it for appending
+func OpenJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{
+		f:         f,
+		steps:     make(map[int]Step),
+		keyCounts: make(map[int]int),
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		entry := JournalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// the last line may be torn if the process died while writing it
+			fmt.Printf("journal %s line %d ignored: %s\n", path, line, err)
+			continue
+		}
+
+		if entry.Plan != nil {
+			j.plan, j.verify = entry.Plan, entry.Verify
+			continue
+		}
+
+		if entry.Step > j.steps[entry.Slot] {
+			j.steps[entry.Slot] = entry.Step
+		}
+		if entry.KeyCount > 0 {
+			j.keyCounts[entry.Slot] = entry.KeyCount
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if j.plan == nil {
+		f.Close()
+		return nil, fmt.Errorf("journal %s has no plan", path)
+	}
+
+	// entries appended after a torn last line would be torn as well
+	if err := j.endLine(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return j, nil
+}
+
+func (j *Journal) Plan() *rh.MigrationPlan {
+	return j.plan
+}
+
+// Verify tells whether the slots of the journal are verified once finalized
+func (j *Journal) Verify() bool {
+	return j != nil && j.verify
+}
+
+// Done tells whether slot reached the last step of the journal, StepVerified or StepFinalized
+func (j *Journal) Done(slot int) bool {
+	if j == nil {
+		return false
+	}
+
+	if j.verify {
+		return j.Step(slot) >= StepVerified
+	}
+	return j.Step(slot) >= StepFinalized
+}
+
+// Unfinished returns the moves of the plan not done
+func (j *Journal) Unfinished() []rh.SlotMove {
+	var moves []rh.SlotMove
+	for _, move := range j.plan.Moves {
+		if !j.Done(move.Slot) {
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// CheckTopology returns an error if a slot not done is owned by neither the source nor the destination
+// of its move, or if one of them is no longer a master
+func (j *Journal) CheckTopology(nodes []*rh.ClusterNode) error {
+	masters := make(map[string]*rh.ClusterNode)
+	for _, node := range nodes {
+		if node.IsMaster() {
+			masters[node.ID] = node
+		}
+	}
+
+	for _, move := range j.Unfinished() {
+		src, dst := masters[move.SrcNodeID], masters[move.DstNodeID]
+		if src == nil || dst == nil {
+			return fmt.Errorf("slot %d: src %s or dst %s is no longer a master", move.Slot, move.SrcNodeID, move.DstNodeID)
+		}
+
+		// the destination may already own the slot if the process died while finalizing it
+		if !src.Slots.IsSet(move.Slot) && !dst.Slots.IsSet(move.Slot) {
+			return fmt.Errorf("slot %d owned by neither src %s nor dst %s", move.Slot, move.SrcNodeID, move.DstNodeID)
+		}
+	}
+
+	return nil
+}
+
+// Step returns the last confirmed step of slot
+func (j *Journal) Step(slot int) Step {
+	if j == nil {
+		return StepNone
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.steps[slot]
+}
+
+// KeyCount returns the keys migrated of slot, recorded with StepKeysMoved
+func (j *Journal) KeyCount(slot int) int {
+	if j == nil {
+		return 0
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.keyCounts[slot]
+}
+
+// Record appends step of move and syncs it to disk
+func (j *Journal) Record(move rh.SlotMove, step Step, keyCount int) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	err := j.write(&JournalEntry{
+		Time:      time.Now(),
+		Slot:      move.Slot,
+		SrcNodeID: move.SrcNodeID,
+		DstNodeID: move.DstNodeID,
+		Step:      step,
+		KeyCount:  keyCount,
+	})
+	if err != nil {
+		return err
+	}
+
+	j.steps[move.Slot] = step
+	if keyCount > 0 {
+		j.keyCounts[move.Slot] = keyCount
+	}
+	return nil
+}
+
+// endLine terminates the last line of the journal if it is not
+func (j *Journal) endLine() error {
+	info, err := j.f.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+
+	last := make([]byte, 1)
+	if _, err := j.f.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+
+	if _, err := j.f.Write([]byte{'\n'}); err != nil {
+		return fmt.Errorf("write journal: %v", err)
+	}
+	return j.f.Sync()
+}
+
+func (j *Journal) write(entry *JournalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := j.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write journal: %v", err)
+	}
+
+	return j.f.Sync()
+}
+
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	return j.f.Close()
+}
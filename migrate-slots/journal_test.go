@@ -0,0 +1,140 @@
+package migrate_slots
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+)
+
+func TestOpenJournal(t *testing.T) {
+	moves := []rh.SlotMove{
+		{Slot: 1, SrcNodeID: "a", DstNodeID: "b"},
+		{Slot: 2, SrcNodeID: "a", DstNodeID: "b"},
+		{Slot: 3, SrcNodeID: "b", DstNodeID: "a"},
+	}
+	plan := &rh.MigrationPlan{Addr: "a:6379", Moves: moves}
+
+	tests := []struct {
+		name   string
+		verify bool
+		// tail is appended to the journal once the steps are recorded
+		tail       string
+		steps      map[int]Step
+		keyCounts  map[int]int
+		unfinished []int
+	}{
+		{
+			name:       "recorded steps",
+			steps:      map[int]Step{1: StepFinalized, 2: StepKeysMoved, 3: StepNone},
+			keyCounts:  map[int]int{1: 10, 2: 20},
+			unfinished: []int{2, 3},
+		},
+		{
+			name:       "torn last line",
+			tail:       `{"time":"2024-10-18T12:00:00Z","slot":3,"src_node_id":"b","dst_no`,
+			steps:      map[int]Step{1: StepFinalized, 2: StepKeysMoved, 3: StepNone},
+			keyCounts:  map[int]int{1: 10, 2: 20},
+			unfinished: []int{2, 3},
+		},
+		{
+			name:       "torn last line after a newline",
+			tail:       "\n{\"slot\":3,\"st",
+			steps:      map[int]Step{1: StepFinalized, 2: StepKeysMoved, 3: StepNone},
+			keyCounts:  map[int]int{1: 10, 2: 20},
+			unfinished: []int{2, 3},
+		},
+		{
+			name:       "finalized slots are not done until verified",
+			verify:     true,
+			steps:      map[int]Step{1: StepFinalized, 2: StepKeysMoved, 3: StepNone},
+			keyCounts:  map[int]int{1: 10, 2: 20},
+			unfinished: []int{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "migrate-slots.journal")
+
+			j, err := CreateJournal(path, plan, tt.verify, false)
+			if err != nil {
+				t.Fatalf("CreateJournal error: %s", err)
+			}
+			// record the steps of move up to last, the key count from StepKeysMoved on like MigrateSlot
+			record := func(move rh.SlotMove, last Step, keyCount int) {
+				for step := StepImporting; step <= last; step++ {
+					count := 0
+					if step >= StepKeysMoved {
+						count = keyCount
+					}
+					if err := j.Record(move, step, count); err != nil {
+						t.Fatalf("Record error: %s", err)
+					}
+				}
+			}
+			record(moves[0], StepFinalized, 10)
+			record(moves[1], StepKeysMoved, 20)
+			j.Close()
+
+			if tt.tail != "" {
+				f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+				if err != nil {
+					t.Fatalf("open journal error: %s", err)
+				}
+				f.WriteString(tt.tail)
+				f.Close()
+			}
+
+			j, err = OpenJournal(path)
+			if err != nil {
+				t.Fatalf("OpenJournal error: %s", err)
+			}
+			defer j.Close()
+
+			if !reflect.DeepEqual(j.Plan(), plan) {
+				t.Errorf("Plan = %+v, want %+v", j.Plan(), plan)
+			}
+			if j.Verify() != tt.verify {
+				t.Errorf("Verify = %v, want %v", j.Verify(), tt.verify)
+			}
+			for slot, step := range tt.steps {
+				if got := j.Step(slot); got != step {
+					t.Errorf("Step(%d) = %s, want %s", slot, got, step)
+				}
+				if got := j.KeyCount(slot); got != tt.keyCounts[slot] {
+					t.Errorf("KeyCount(%d) = %d, want %d", slot, got, tt.keyCounts[slot])
+				}
+			}
+
+			var unfinished []int
+			for _, move := range j.Unfinished() {
+				unfinished = append(unfinished, move.Slot)
+			}
+			if !reflect.DeepEqual(unfinished, tt.unfinished) {
+				t.Errorf("Unfinished = %v, want %v", unfinished, tt.unfinished)
+			}
+
+			// the journal is appended to after the torn line
+			if err := j.Record(moves[2], StepImporting, 0); err != nil {
+				t.Fatalf("Record error: %s", err)
+			}
+			j.Close()
+
+			j, err = OpenJournal(path)
+			if err != nil {
+				t.Fatalf("OpenJournal error: %s", err)
+			}
+			defer j.Close()
+			if got := j.Step(3); got != StepImporting {
+				t.Errorf("Step(3) after reopen = %s, want %s", got, StepImporting)
+			}
+
+			if err := CheckJournalFinished(path); err == nil {
+				t.Errorf("CheckJournalFinished of an unfinished journal, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package migrate_slots
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// PushJob is the job the metrics are pushed under
+	PushJob = "redis_tools_migrate"
+	// PushInterval is the interval between two pushes of the metrics
+	PushInterval = 10 * time.Second
+)
+
+// Gatherer gathers the metrics of the migration and of the redis clients
+var Gatherer = prometheus.Gatherers{metrics.Registry, prometheus.DefaultGatherer}
+
+// StartMetrics serves the metrics on MetricsAddr and pushes them to Pushgateway every PushInterval,
+// as set in opts. The returned stop pushes the metrics a last time.
+func StartMetrics(opts *Options) (stop func()) {
+	if opts.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(Gatherer, promhttp.HandlerOpts{}))
+
+		server := &http.Server{Addr: opts.MetricsAddr, Handler: mux}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Printf("metrics server error. addr:%s, err:%s\n", opts.MetricsAddr, err)
+			}
+		}()
+		fmt.Printf("metrics served on http://%s/metrics\n", opts.MetricsAddr)
+	}
+
+	if opts.Pushgateway == "" {
+		return func() {}
+	}
+
+	pusher := push.New(opts.Pushgateway, PushJob).Gatherer(Gatherer)
+	if opts.ClusterName != "" {
+		pusher = pusher.Grouping("cluster_name", opts.ClusterName)
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(PushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+
+			if err := pusher.Push(); err != nil {
+				fmt.Printf("push metrics error. url:%s, err:%s\n", opts.Pushgateway, err)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+
+		if err := pusher.Push(); err != nil {
+			fmt.Printf("push metrics error. url:%s, err:%s\n", opts.Pushgateway, err)
+		}
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	"github.com/geesugar/redis-tools/pkg/prom/migrateprom"
 	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
 	"github.com/spf13/cobra"
 )
@@ -12,12 +15,18 @@ import (
 const (
 	MigrateBatchKeys     = 1000
 	MigrateTimeoutSecond = 300
+	BigKeyTimeoutSecond  = 1800
+	VerifySamples        = 20
 )
 
 var (
 	addr   string
 	nodeID string
 	slots  string
+	planIn string
+	resume bool
+
+	options = DefaultOptions()
 )
 
 func NewMigrationSlotsCmd() *cobra.Command {
@@ -28,93 +37,189 @@ func NewMigrationSlotsCmd() *cobra.Command {
 
 	cmd.Flags().StringVarP(&addr, "addr", "", "", "redis addr")
 	cmd.Flags().StringVarP(&nodeID, "node_id", "", "", "node id")
-	cmd.Flags().StringVarP(&slots, "slots", "", "", "slots")
+	cmd.Flags().StringVarP(&slots, "slots", "", "", "slots and slot ranges, e.g. \"0-100 200 300-400\"")
+	cmd.Flags().StringVarP(&planIn, "plan-in", "", "", "apply the migration plan from this file instead of --node_id and --slots")
+	cmd.Flags().BoolVarP(&resume, "resume", "", false, "resume the migration recorded in --journal from the last confirmed step of each slot")
+
+	options.AddFlags(cmd.Flags())
+	options.AddPlanFlags(cmd.Flags())
 
 	return cmd
 }
 
 func Run(cmd *cobra.Command, args []string) {
-	fmt.Printf("addr:%s node:%s slots:%s\n", addr, nodeID, slots)
-
 	ctx := context.Background()
 
-	nodes, err := rh.GetClusterNodes(ctx, addr)
-	if err != nil {
-		log.Fatalf("GetClusterNodes error: %s", err)
-	}
+	var (
+		plan *rh.MigrationPlan
+		jl   *Journal
+		err  error
+	)
 
-	node := GetNodeByID(nodes, nodeID)
-	if node == nil {
-		log.Fatalf("node not found. node_id:%s", nodeID)
+	// the plan of the journal or of --plan-in replaces --node_id and --slots
+	if (resume || planIn != "") && (nodeID != "" || slots != "") {
+		log.Fatalf("--node_id and --slots can not be combined with --plan-in or --resume")
+	}
+	if resume && planIn != "" {
+		log.Fatalf("--plan-in can not be combined with --resume, the plan is read from the journal")
 	}
 
-	if !node.IsMaster() {
-		log.Fatalf("node is not master. node_id:%s", nodeID)
+	if resume {
+		if options.JournalPath == "" {
+			log.Fatalf("--resume needs the --journal printed by the interrupted migration")
+		}
+
+		jl, err = OpenJournal(options.JournalPath)
+		if err != nil {
+			log.Fatalf("open journal error: %s", err)
+		}
+		defer jl.Close()
+
+		plan = jl.Plan()
+		// the slots of a journal created with --verify are done once verified
+		options.Verify = options.Verify || jl.Verify()
+		if addr == "" {
+			addr = plan.Addr
+		}
+	} else if planIn != "" {
+		plan, err = rh.ReadPlan(planIn)
+		if err != nil {
+			log.Fatalf("read plan error: %s", err)
+		}
+
+		if addr == "" {
+			addr = plan.Addr
+		}
 	}
 
-	specSlots := rh.NewSlots()
-	err = specSlots.SetSlotSlice(slots)
+	nodes, err := rh.GetClusterNodes(ctx, addr, conn_options.Options)
 	if err != nil {
-		log.Fatalf("parse slots slice error: %s", err)
+		log.Fatalf("GetClusterNodes error: %s", err)
 	}
 
-	equl, diff := node.Slots.Compare(specSlots)
-	if equl {
-		fmt.Printf("slots is equal\n")
-		return
+	masterCliMap, err := NewMasterClients(ctx, nodes)
+	if err != nil {
+		log.Fatalf("new master clients error: %s", err)
 	}
+	defer CloseClients(masterCliMap)
 
-	fmt.Printf("slots is not equal. diff:%s\n", diff)
+	if jl != nil {
+		// part of the plan was applied, so the topology is expected to differ from it
+		fmt.Printf("addr:%s resume journal:%s created_at:%s\n", addr, options.JournalPath, plan.CreatedAt)
 
-	// press enter to continue
-	var input string
-	fmt.Printf("press enter to continue...")
-	fmt.Scanln(&input)
+		if err := jl.CheckTopology(nodes); err != nil {
+			log.Fatalf("refuse to resume journal: %s", err)
+		}
+	} else if plan != nil {
+		fmt.Printf("addr:%s plan:%s created_at:%s\n", addr, planIn, plan.CreatedAt)
+
+		if err := plan.CheckTopology(nodes); err != nil {
+			log.Fatalf("refuse to apply plan: %s", err)
+		}
+	} else {
+		fmt.Printf("addr:%s node:%s slots:%s\n", addr, nodeID, slots)
+
+		node := GetNodeByID(nodes, nodeID)
+		if node == nil {
+			log.Fatalf("node not found. node_id:%s", nodeID)
+		}
 
-	masterCliMap := make(map[string]*rh.Client, len(nodes))
-	for _, node := range nodes {
 		if !node.IsMaster() {
-			continue
+			log.Fatalf("node is not master. node_id:%s", nodeID)
 		}
 
-		cli, err := rh.NewClient(ctx, node.Addr, "", "")
+		specSlots, err := rh.ParseSlots(slots)
 		if err != nil {
-			log.Fatalf("new client. addr:%s, err:%s", node.Addr, err)
+			log.Fatalf("parse slots slice error: %s", err)
 		}
-		defer cli.Close()
 
-		masterCliMap[node.Addr] = cli
-	}
+		diff := node.Slots.Compare(specSlots)
+		if diff.IsEmpty() {
+			fmt.Printf("slots is equal\n")
+			return
+		}
 
-	for slot, set := range specSlots {
-		if !set {
-			continue
+		fmt.Printf("slots is not equal. diff:%s\n", diff)
+
+		plan, err = BuildPlan(ctx, addr, masterCliMap, nodes, node, specSlots)
+		if err != nil {
+			log.Fatalf("build plan error: %s", err)
 		}
+	}
 
-		if node.Slots[slot] {
-			continue
+	RunPlan(ctx, masterCliMap, plan, jl, options)
+}
+
+// RunPlan prints plan and writes it to --plan-out, then unless --dry-run applies it
+// after confirmation, journaling every step to --journal, or DefaultJournalPath, unless jl is already open.
+func RunPlan(ctx context.Context, masterCliMap map[string]*rh.Client, plan *rh.MigrationPlan, jl *Journal, opts *Options) {
+	PrintPlan(plan)
+
+	if opts.PlanOut != "" {
+		if err := rh.WritePlan(opts.PlanOut, plan); err != nil {
+			log.Fatalf("write plan error: %s", err)
 		}
+		fmt.Printf("plan written to %s\n", opts.PlanOut)
+	}
 
-		// find a node which has this slot
-		var srcNode *rh.ClusterNode
-		for _, node := range nodes {
-			if !node.IsMaster() {
-				continue
-			}
+	if opts.DryRun || len(plan.Moves) == 0 {
+		return
+	}
 
-			if node.Slots[slot] {
-				srcNode = node
-				break
-			}
+	// commands sharing a journal would refuse or resume the plans of each other
+	if jl == nil && opts.JournalPath == "" {
+		opts.JournalPath = DefaultJournalPath(plan)
+	}
+
+	if jl == nil && !opts.ForceJournal {
+		if err := CheckJournalFinished(opts.JournalPath); err != nil {
+			log.Fatalf("refuse to start: %s", err)
 		}
+	}
+
+	fmt.Printf("journal:%s\n", opts.JournalPath)
+
+	// press enter to continue
+	var input string
+	fmt.Printf("press enter to continue...")
+	fmt.Scanln(&input)
+
+	// the cluster may have changed while waiting for confirmation
+	if err := CheckPlanTopology(ctx, plan, jl); err != nil {
+		log.Fatalf("refuse to apply plan: %s", err)
+	}
 
-		keyCount, err := MigrateSlot(ctx, masterCliMap, srcNode.Addr, node.Addr, srcNode.ID, node.ID, slot)
+	if jl == nil {
+		var err error
+		jl, err = CreateJournal(opts.JournalPath, plan, opts.Verify, opts.ForceJournal)
 		if err != nil {
-			log.Fatalf("migrate slot error: %s", err)
+			log.Fatalf("create journal error: %s", err)
 		}
+		defer jl.Close()
+	}
+
+	stopMetrics := StartMetrics(opts)
+	migrator := NewMigrator(masterCliMap, jl, opts)
+	err := migrator.ApplyPlan(ctx, plan)
+	stopMetrics()
+	migrator.PrintProblems()
+	if err != nil {
+		log.Fatalf("migrate slot error: %s. run migrate-slots --resume --journal %s to continue", err, opts.JournalPath)
+	}
+}
 
-		fmt.Printf("migrate slot success. slot:%d, key_count:%d src_node_id:%s, dst_node_id:%s\n", slot, keyCount, srcNode.ID, node.ID)
+// CheckPlanTopology reads the cluster nodes from plan.Addr and checks them against the topology of plan,
+// or if jl is open, checks every slot not done is still owned by its source or destination
+func CheckPlanTopology(ctx context.Context, plan *rh.MigrationPlan, jl *Journal) error {
+	nodes, err := rh.GetClusterNodes(ctx, plan.Addr, conn_options.Options)
+	if err != nil {
+		return err
+	}
+
+	if jl != nil {
+		return jl.CheckTopology(nodes)
 	}
+	return plan.CheckTopology(nodes)
 }
 
 func GetNodeByID(nodes []*rh.ClusterNode, id string) *rh.ClusterNode {
@@ -126,7 +231,14 @@ func GetNodeByID(nodes []*rh.ClusterNode, id string) *rh.ClusterNode {
 	return nil
 }
 
-func MigrateSlot(ctx context.Context, masterCliMap map[string]*rh.Client, srcAddr, dstAddr string, srcNodeID, dstNodeID string, slot int) (int, error) {
+// MigrateSlot moves move.Slot from its source to its destination. Steps already
+// confirmed in the journal are skipped, so an interrupted migration can be resumed.
+func (m *Migrator) MigrateSlot(ctx context.Context, move rh.SlotMove) (int, error) {
+	masterCliMap, journal := m.masterCliMap, m.journal
+	srcAddr, dstAddr := move.SrcAddr, move.DstAddr
+	srcNodeID, dstNodeID := move.SrcNodeID, move.DstNodeID
+	slot := move.Slot
+
 	srcCli, ok := masterCliMap[srcAddr]
 	if !ok {
 		return 0, fmt.Errorf("src addr not found. addr:%s", srcAddr)
@@ -137,30 +249,110 @@ func MigrateSlot(ctx context.Context, masterCliMap map[string]*rh.Client, srcAdd
 		return 0, fmt.Errorf("dst addr not found. addr:%s", dstAddr)
 	}
 
-	err := dstCli.ClusterSetSlot(ctx, slot, "IMPORTING", srcNodeID)
-	if err != nil {
-		return 0, fmt.Errorf("cluster set slot IMPORTING. addr:%s, slot:%d, src_node_id:%s, err:%s", dstAddr, slot, srcNodeID, err)
+	if journal.Done(slot) {
+		return 0, nil
 	}
+	step := journal.Step(slot)
 
-	err = srcCli.ClusterSetSlot(ctx, slot, "MIGRATING", dstNodeID)
-	if err != nil {
-		return 0, fmt.Errorf("cluster set slot MIGRATING. addr:%s, slot:%d, dst_node_id:%s, err:%s", srcAddr, slot, dstNodeID, err)
+	start := time.Now()
+
+	if step < StepImporting {
+		err := dstCli.ClusterSetSlot(ctx, slot, "IMPORTING", srcNodeID)
+		if err != nil {
+			return 0, fmt.Errorf("cluster set slot IMPORTING. addr:%s, slot:%d, src_node_id:%s, err:%s", dstAddr, slot, srcNodeID, err)
+		}
+
+		if err := journal.Record(move, StepImporting, 0); err != nil {
+			return 0, err
+		}
 	}
 
-	// wait for slot migration
-	keyCount, err := MigrateKeys(ctx, srcCli, dstCli, slot)
-	if err != nil {
-		return 0, fmt.Errorf("migrate keys. slot:%d, err:%s", slot, err)
+	if step < StepMigrating {
+		err := srcCli.ClusterSetSlot(ctx, slot, "MIGRATING", dstNodeID)
+		if err != nil {
+			return 0, fmt.Errorf("cluster set slot MIGRATING. addr:%s, slot:%d, dst_node_id:%s, err:%s", srcAddr, slot, dstNodeID, err)
+		}
+
+		if err := journal.Record(move, StepMigrating, 0); err != nil {
+			return 0, err
+		}
+	}
+
+	// a slot resumed after StepKeysMoved keeps the key count recorded by the previous run
+	keyCount := journal.KeyCount(slot)
+	var samples []KeySample
+	if step < StepKeysMoved {
+		// samples of a resumed slot miss the keys already moved, it is still checked for keys left on the source
+		if m.opts.Verify {
+			var err error
+			samples, err = SampleKeys(ctx, srcCli, slot, m.opts.VerifySamples)
+			if err != nil {
+				return 0, fmt.Errorf("sample keys. slot:%d, err:%s", slot, err)
+			}
+		}
+
+		// wait for slot migration
+		var err error
+		keyCount, err = m.MigrateKeys(ctx, move)
+		if _, ok := err.(*SkippedKeysError); ok {
+			// the skipped keys would be lost by finalizing the slot
+			return keyCount, err
+		}
+		if err != nil {
+			return 0, fmt.Errorf("migrate keys. slot:%d, err:%s", slot, err)
+		}
+
+		if err := journal.Record(move, StepKeysMoved, keyCount); err != nil {
+			return 0, err
+		}
+	}
+
+	if step < StepFinalized {
+		if err := FinalizeSlot(ctx, masterCliMap, srcAddr, dstAddr, dstNodeID, slot); err != nil {
+			return 0, err
+		}
+
+		if err := journal.Record(move, StepFinalized, keyCount); err != nil {
+			return 0, err
+		}
+	}
+
+	// a slot finalized but not verified before an interruption is verified again on resume, without samples
+	if m.opts.Verify {
+		if err := VerifySlot(ctx, srcCli, dstCli, move, keyCount, samples); err != nil {
+			return 0, fmt.Errorf("%s. the slot is finalized, the migration stops", err)
+		}
+
+		if err := journal.Record(move, StepVerified, keyCount); err != nil {
+			return 0, err
+		}
 	}
 
-	err = dstCli.ClusterSetSlot(ctx, slot, "NODE", dstNodeID)
+	migrateprom.SetSlotDone(m.opts.ClusterID, m.opts.ClusterName, srcNodeID, dstNodeID, time.Since(start).Seconds())
+
+	return keyCount, nil
+}
+
+// FinalizeSlot assigns slot to dstNodeID, on the destination first, then the source, then every other master
+func FinalizeSlot(ctx context.Context, masterCliMap map[string]*rh.Client, srcAddr, dstAddr string, dstNodeID string, slot int) error {
+	srcCli, ok := masterCliMap[srcAddr]
+	if !ok {
+		return fmt.Errorf("src addr not found. addr:%s", srcAddr)
+	}
+
+	dstCli, ok := masterCliMap[dstAddr]
+	if !ok {
+		return fmt.Errorf("dst addr not found. addr:%s", dstAddr)
+	}
+
+	err := dstCli.ClusterSetSlot(ctx, slot, "NODE", dstNodeID)
 	if err != nil {
-		return 0, fmt.Errorf("cluster set slot NODE. addr:%s, slot:%d, dst_node_id:%s, err:%s", dstAddr, slot, dstNodeID, err)
+		return fmt.Errorf("cluster set slot NODE. addr:%s, slot:%d, dst_node_id:%s, err:%s", dstAddr, slot, dstNodeID, err)
 	}
 
 	err = srcCli.ClusterSetSlot(ctx, slot, "NODE", dstNodeID)
 	if err != nil {
-		return 0, fmt.Errorf("cluster set slot NODE. addr:%s, slot:%d, dst_node_id:%s, err:%s", srcAddr, slot, dstNodeID, err)
+		return fmt.Errorf("cluster set slot NODE. addr:%s, slot:%d, dst_node_id:%s, err:%s", srcAddr, slot, dstNodeID, err)
 	}
 
 	for _, cli := range masterCliMap {
@@ -174,43 +366,155 @@ func MigrateSlot(ctx context.Context, masterCliMap map[string]*rh.Client, srcAdd
 		}
 	}
 
-	return keyCount, nil
+	return nil
 }
 
-func MigrateKeys(ctx context.Context, srcCli, dstCli *rh.Client, slot int) (int, error) {
+// MigrateKeys migrates the keys of the slot of move from its source to its destination. Keys skipped by the
+// conflict policy stay on the source, the migration then goes on with the other keys and returns a SkippedKeysError.
+func (m *Migrator) MigrateKeys(ctx context.Context, move rh.SlotMove) (int, error) {
+	srcCli, ok := m.masterCliMap[move.SrcAddr]
+	if !ok {
+		return 0, fmt.Errorf("src addr not found. addr:%s", move.SrcAddr)
+	}
+
+	dstCli, ok := m.masterCliMap[move.DstAddr]
+	if !ok {
+		return 0, fmt.Errorf("dst addr not found. addr:%s", move.DstAddr)
+	}
+
+	slot := move.Slot
+	batchKeys := m.opts.BatchKeys
 	keyCount := 0
-	cmds := make([]interface{}, MigrateBatchKeys+7)
+	skipped := make(map[string]bool)
 
 	for {
-		cmd := srcCli.ClusterGetKeysInSlot(ctx, slot, MigrateBatchKeys)
+		// skipped keys stay in the slot, fetch enough keys to get a full batch besides them
+		count := batchKeys + len(skipped)
+		cmd := srcCli.ClusterGetKeysInSlot(ctx, slot, count)
 		if cmd.Err() != nil {
-			return 0, fmt.Errorf("cluster get keys in slot. slot:%d, batch_keys:%d, err:%s", slot, MigrateBatchKeys, cmd.Err())
+			return 0, fmt.Errorf("cluster get keys in slot. slot:%d, batch_keys:%d, err:%s", slot, batchKeys, cmd.Err())
+		}
+
+		var keys []string
+		for _, key := range cmd.Val() {
+			if !skipped[key] {
+				keys = append(keys, key)
+			}
 		}
 
-		if len(cmd.Val()) == 0 {
+		if len(keys) == 0 {
 			break
 		}
 
-		cmds = cmds[:0]
-		cmds = append(cmds, "MIGRATE")
-		cmds = append(cmds, dstCli.Host)
-		cmds = append(cmds, dstCli.Port)
-		cmds = append(cmds, "")
-		cmds = append(cmds, "0")
-		cmds = append(cmds, MigrateTimeoutSecond)
+		var (
+			bigKeys []rh.KeySize
+			bytes   int64
+		)
+		if m.needSizes() {
+			sizes, err := srcCli.KeySizes(ctx, keys, m.opts.BigKeyLength > 0)
+			if err != nil {
+				return 0, fmt.Errorf("key sizes. slot:%d, err:%s", slot, err)
+			}
 
-		cmds = append(cmds, "KEYS")
-		for _, k := range cmd.Val() {
-			cmds = append(cmds, k)
+			keys = keys[:0]
+			for _, size := range sizes {
+				bytes += size.Bytes
+				if m.isBigKey(size) {
+					bigKeys = append(bigKeys, size)
+				} else {
+					keys = append(keys, size.Key)
+				}
+			}
 		}
 
-		migrateCmd := srcCli.Do(ctx, cmds...)
-		if migrateCmd.Err() != nil {
-			return 0, fmt.Errorf("migrate keys. slot:%d, batch_keys:%d, keyCount:%d curKeys:%d, err:%s", slot, MigrateBatchKeys, keyCount, len(cmd.Val()), migrateCmd.Err())
+		if len(bigKeys) > 0 {
+			switch m.opts.BigKeyPolicy {
+			case BigKeyPolicyRefuse:
+				return 0, &BigKeysError{Slot: slot, Keys: bigKeys}
+			case BigKeyPolicySeparate:
+			default:
+				return 0, fmt.Errorf("unknown big key policy %s", m.opts.BigKeyPolicy)
+			}
 		}
 
-		keyCount += len(cmd.Val())
+		if err := m.throttle(ctx, len(keys)+len(bigKeys), bytes); err != nil {
+			return 0, fmt.Errorf("throttle. slot:%d, err:%s", slot, err)
+		}
+
+		if len(keys) > 0 {
+			skippedKeys, err := m.migrateBatch(slot, keys, func(keys []string, replace bool) error {
+				return m.migrate(ctx, srcCli, dstCli, keys, m.opts.MigrateTimeout, replace)
+			})
+			if err != nil {
+				return 0, fmt.Errorf("migrate keys. slot:%d, batch_keys:%d, keyCount:%d curKeys:%d, err:%s", slot, batchKeys, keyCount, len(keys), err)
+			}
+
+			for _, key := range skippedKeys {
+				skipped[key] = true
+			}
+			keyCount += len(keys) - len(skippedKeys)
+			migrateprom.AddKeysMoved(m.opts.ClusterID, m.opts.ClusterName, move.SrcNodeID, move.DstNodeID, len(keys)-len(skippedKeys))
+		}
+
+		for _, size := range bigKeys {
+			fmt.Printf("migrate big key. slot:%d, key:%q, type:%s, bytes:%d, length:%d\n", slot, size.Key, size.Type, size.Bytes, size.Length)
+
+			skippedKeys, err := m.migrateBatch(slot, []string{size.Key}, func(keys []string, replace bool) error {
+				return m.migrate(ctx, srcCli, dstCli, keys, m.opts.BigKeyTimeout, replace)
+			})
+			if err != nil {
+				return 0, fmt.Errorf("migrate big key. slot:%d, key:%q, bytes:%d, keyCount:%d, err:%s", slot, size.Key, size.Bytes, keyCount, err)
+			}
+
+			for _, key := range skippedKeys {
+				skipped[key] = true
+			}
+			keyCount += 1 - len(skippedKeys)
+			migrateprom.AddKeysMoved(m.opts.ClusterID, m.opts.ClusterName, move.SrcNodeID, move.DstNodeID, 1-len(skippedKeys))
+		}
+
+		// the skipped keys are few, the bytes of the batch are counted whole
+		migrateprom.AddBytesMoved(m.opts.ClusterID, m.opts.ClusterName, move.SrcNodeID, move.DstNodeID, bytes)
+	}
+
+	if len(skipped) > 0 {
+		return keyCount, &SkippedKeysError{Slot: slot, Keys: len(skipped)}
 	}
 
 	return keyCount, nil
 }
+
+// migrate moves keys from srcCli to dstCli with a single MIGRATE, the reply is awaited as long as the MIGRATE timeout
+func (m *Migrator) migrate(ctx context.Context, srcCli, dstCli *rh.Client, keys []string, timeout time.Duration, replace bool) error {
+	cmds := make([]interface{}, 0, len(keys)+11)
+	cmds = append(cmds, "MIGRATE")
+	cmds = append(cmds, dstCli.Host)
+	cmds = append(cmds, dstCli.Port)
+	cmds = append(cmds, "")
+	cmds = append(cmds, "0")
+	cmds = append(cmds, timeout.Milliseconds())
+	if replace {
+		cmds = append(cmds, "REPLACE")
+	}
+	cmds = appendMigrateAuth(cmds, srcCli.Options)
+
+	cmds = append(cmds, "KEYS")
+	for _, k := range keys {
+		cmds = append(cmds, k)
+	}
+
+	return srcCli.WithReadTimeout(timeout).Do(ctx, cmds...).Err()
+}
+
+// appendMigrateAuth appends the AUTH2 or AUTH clause of MIGRATE, the destination shares the credentials of the source
+func appendMigrateAuth(cmds []interface{}, opts *rh.ConnOptions) []interface{} {
+	if opts == nil || opts.Password == "" {
+		return cmds
+	}
+
+	if opts.Username != "" {
+		return append(cmds, "AUTH2", opts.Username, opts.Password)
+	}
+
+	return append(cmds, "AUTH", opts.Password)
+}
@@ -0,0 +1,324 @@
+package migrate_slots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geesugar/redis-tools/pkg/prom/migrateprom"
+	"github.com/geesugar/redis-tools/pkg/prom/runtimeprom"
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/spf13/pflag"
+	"golang.org/x/time/rate"
+)
+
+// Options tunes how slots are migrated
+type Options struct {
+	// Parallel is the max number of slots migrated at the same time, a node takes part in one migration at a time
+	Parallel int
+	// BatchKeys is the number of keys sent by one MIGRATE
+	BatchKeys int
+	// MigrateTimeout is the timeout of MIGRATE, sent in milliseconds as its timeout argument
+	// and awaited as the read timeout of the reply
+	MigrateTimeout time.Duration
+	// KeysPerSecond limits the keys migrated per second by all workers, 0 means unlimited
+	KeysPerSecond int
+	// BytesPerSecond limits the bytes migrated per second by all workers, 0 means unlimited.
+	// The size of each key is estimated with MEMORY USAGE.
+	BytesPerSecond int
+
+	// BigKeyBytes is the MEMORY USAGE above which a key is big, 0 disables the check
+	BigKeyBytes int64
+	// BigKeyLength is the length, elements or string bytes, above which a key is big, 0 disables the check
+	BigKeyLength int64
+	// BigKeyPolicy is what to do with big keys: BigKeyPolicySeparate or BigKeyPolicyRefuse
+	BigKeyPolicy string
+	// BigKeyTimeout is the timeout of the MIGRATE of a single big key, sent like MigrateTimeout
+	BigKeyTimeout time.Duration
+
+	// Replace migrates every key with REPLACE, overwriting the keys already existing on the destination
+	Replace bool
+	// ConflictPolicy is what to do with a key failing to migrate on its own:
+	// ConflictPolicyFail, ConflictPolicyReplace or ConflictPolicySkipAndReport
+	ConflictPolicy string
+
+	// DryRun prints the plan without moving any slot
+	DryRun bool
+	// PlanOut is the file the plan is written to, yaml if it ends with .yaml/.yml, otherwise json
+	PlanOut string
+	// JournalPath is the file recording the state transitions of each slot, see Journal.
+	// Empty means DefaultJournalPath of the plan.
+	JournalPath string
+	// ForceJournal overwrites a journal at JournalPath whose slots are not all finalized
+	ForceJournal bool
+	// Verify checks every finalized slot with VerifySlot, a failed check stops the migration
+	Verify bool
+	// VerifySamples is the number of keys of each slot whose value is compared by Verify
+	VerifySamples int
+
+	// MetricsAddr is the addr serving the metrics of the migration on /metrics, empty disables it
+	MetricsAddr string
+	// Pushgateway is the url of a Pushgateway the metrics are pushed to, empty disables it
+	Pushgateway string
+	// ClusterID and ClusterName label the migration duration
+	ClusterID   string
+	ClusterName string
+}
+
+const (
+	// BigKeyPolicySeparate migrates every big key on its own with BigKeyTimeout
+	BigKeyPolicySeparate = "separate"
+	// BigKeyPolicyRefuse stops the migration of the slot, leaving it open, when it holds a big key
+	BigKeyPolicyRefuse = "refuse"
+)
+
+func DefaultOptions() *Options {
+	return &Options{
+		Parallel:       1,
+		BatchKeys:      MigrateBatchKeys,
+		MigrateTimeout: MigrateTimeoutSecond * time.Second,
+		BigKeyPolicy:   BigKeyPolicySeparate,
+		BigKeyTimeout:  BigKeyTimeoutSecond * time.Second,
+		ConflictPolicy: ConflictPolicyFail,
+		VerifySamples:  VerifySamples,
+	}
+}
+
+// DefaultJournalPath names the journal of plan after its topology fingerprint,
+// so commands planning from different topologies don't share a journal
+func DefaultJournalPath(plan *rh.MigrationPlan) string {
+	return fmt.Sprintf("migrate-slots-%.12s.journal", plan.Topology)
+}
+
+// AddFlags binds the options to fs, so every command migrating slots shares the same flags
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.IntVarP(&o.Parallel, "parallel", "", o.Parallel, "max slots migrated at the same time, each node takes part in one migration at a time")
+	fs.IntVarP(&o.BatchKeys, "batch-keys", "", o.BatchKeys, "keys sent by one MIGRATE")
+	fs.DurationVarP(&o.MigrateTimeout, "migrate-timeout", "", o.MigrateTimeout, "timeout of MIGRATE, sent in milliseconds as its timeout argument, the max idle time talking to the destination, "+
+		"and awaited as the read timeout of its reply. e.g. 300s is sent as 300000, older versions sent a bare 300, i.e. 300ms")
+	fs.IntVarP(&o.KeysPerSecond, "keys-per-second", "", o.KeysPerSecond, "max keys migrated per second by all workers, 0 means unlimited")
+	fs.IntVarP(&o.BytesPerSecond, "bytes-per-second", "", o.BytesPerSecond, "max bytes migrated per second by all workers, 0 means unlimited")
+	fs.Int64VarP(&o.BigKeyBytes, "big-key-bytes", "", o.BigKeyBytes, "keys whose MEMORY USAGE is above are big, 0 disables the check")
+	fs.Int64VarP(&o.BigKeyLength, "big-key-length", "", o.BigKeyLength, "keys with more elements, or string bytes, are big, 0 disables the check")
+	fs.StringVarP(&o.BigKeyPolicy, "big-key-policy", "", o.BigKeyPolicy, "separate migrates each big key on its own with --big-key-timeout, refuse stops the migration of the slot")
+	fs.DurationVarP(&o.BigKeyTimeout, "big-key-timeout", "", o.BigKeyTimeout, "timeout of the MIGRATE of a big key, sent in milliseconds like --migrate-timeout")
+	fs.BoolVarP(&o.Replace, "replace", "", o.Replace, "migrate every key with REPLACE, overwriting the keys already existing on the destination")
+	fs.StringVarP(&o.ConflictPolicy, "conflict-policy", "", o.ConflictPolicy, "what to do with a key failing to migrate once a failed batch is split down to it: "+
+		"fail, replace migrates it again with REPLACE if it exists on the destination, skip-and-report leaves it on the source and the slot open")
+}
+
+// AddPlanFlags binds the options of commands running a migration plan, see RunPlan
+func (o *Options) AddPlanFlags(fs *pflag.FlagSet) {
+	fs.BoolVarP(&o.DryRun, "dry-run", "", o.DryRun, "print the migration plan without moving any slot")
+	fs.StringVarP(&o.PlanOut, "plan-out", "", o.PlanOut, "write the migration plan to this file, yaml if it ends with .yaml/.yml, otherwise json")
+	fs.StringVarP(&o.JournalPath, "journal", "", o.JournalPath, "file recording the state transitions of each slot, migrate-slots-<topology>.journal by default, "+
+		"<topology> being the fingerprint of the cluster the plan was computed from")
+	fs.BoolVarP(&o.ForceJournal, "force-journal", "", o.ForceJournal, "overwrite the journal even if some of its slots are not finalized, losing the ability to resume them")
+	fs.BoolVarP(&o.Verify, "verify", "", o.Verify, "check every finalized slot: no key left on the source, and the DUMP of sampled keys unchanged on the destination. a failed check stops the migration, the slot stays finalized and --resume checks it again")
+	fs.IntVarP(&o.VerifySamples, "verify-samples", "", o.VerifySamples, "keys of each slot sampled by --verify")
+	fs.StringVarP(&o.MetricsAddr, "metrics-addr", "", o.MetricsAddr, "serve the metrics of the migration on this addr, under /metrics")
+	fs.StringVarP(&o.Pushgateway, "pushgateway", "", o.Pushgateway, "push the metrics of the migration to this Pushgateway url")
+	fs.StringVarP(&o.ClusterID, "cluster-id", "", o.ClusterID, "cluster_id label of the metrics")
+	fs.StringVarP(&o.ClusterName, "cluster-name", "", o.ClusterName, "cluster_name label of the metrics")
+}
+
+// Migrator migrates slots between the masters of masterCliMap, which is keyed by addr
+type Migrator struct {
+	masterCliMap map[string]*rh.Client
+	journal      *Journal
+	opts         *Options
+
+	keysLimiter  *rate.Limiter
+	bytesLimiter *rate.Limiter
+
+	mu       sync.Mutex
+	problems []ProblemKey
+}
+
+func NewMigrator(masterCliMap map[string]*rh.Client, journal *Journal, opts *Options) *Migrator {
+	m := &Migrator{
+		masterCliMap: masterCliMap,
+		journal:      journal,
+		opts:         opts,
+	}
+
+	if opts.KeysPerSecond > 0 {
+		m.keysLimiter = rate.NewLimiter(rate.Limit(opts.KeysPerSecond), opts.KeysPerSecond)
+	}
+
+	if opts.BytesPerSecond > 0 {
+		m.bytesLimiter = rate.NewLimiter(rate.Limit(opts.BytesPerSecond), opts.BytesPerSecond)
+	}
+
+	return m
+}
+
+// ApplyPlan migrates every move of plan not yet finalized in the journal,
+// running up to Parallel migrations whose nodes are pairwise disjoint.
+func (m *Migrator) ApplyPlan(ctx context.Context, plan *rh.MigrationPlan) error {
+	var pending []rh.SlotMove
+	for _, move := range plan.Moves {
+		if m.journal.Done(move.Slot) {
+			fmt.Printf("migrate slot skipped, already %s. slot:%d\n", m.journal.Step(move.Slot), move.Slot)
+			continue
+		}
+		pending = append(pending, move)
+		migrateprom.AddSlotsRemaining(m.opts.ClusterID, m.opts.ClusterName, move.SrcNodeID, move.DstNodeID, 1)
+	}
+
+	start := time.Now()
+	defer func() {
+		runtimeprom.SetBatchMigrationSlotsMetrics(m.opts.ClusterID, m.opts.ClusterName, time.Since(start).Seconds())
+	}()
+
+	var (
+		mu       sync.Mutex
+		cond     = sync.NewCond(&mu)
+		busy     = make(map[string]bool)
+		firstErr error
+		skipped  []string
+	)
+
+	// next blocks until a pending move has both nodes idle, it returns false once nothing is left to do
+	next := func() (rh.SlotMove, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for {
+			if firstErr != nil || len(pending) == 0 {
+				return rh.SlotMove{}, false
+			}
+
+			for i, move := range pending {
+				if busy[move.SrcNodeID] || busy[move.DstNodeID] {
+					continue
+				}
+
+				pending = append(pending[:i], pending[i+1:]...)
+				busy[move.SrcNodeID] = true
+				busy[move.DstNodeID] = true
+				return move, true
+			}
+
+			cond.Wait()
+		}
+	}
+
+	done := func(move rh.SlotMove, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		busy[move.SrcNodeID] = false
+		busy[move.DstNodeID] = false
+
+		if err != nil {
+			migrateprom.IncErrors(m.opts.ClusterID, m.opts.ClusterName, move.SrcNodeID, move.DstNodeID)
+		}
+
+		// a slot left open with skipped keys doesn't stop the other slots
+		var skippedErr *SkippedKeysError
+		if errors.As(err, &skippedErr) {
+			skipped = append(skipped, skippedErr.Error())
+		} else if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		cond.Broadcast()
+	}
+
+	parallel := m.opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				move, ok := next()
+				if !ok {
+					return
+				}
+
+				keyCount, err := m.MigrateSlot(ctx, move)
+				if err == nil {
+					fmt.Printf("migrate slot success. slot:%d, key_count:%d src_node_id:%s, dst_node_id:%s\n", move.Slot, keyCount, move.SrcNodeID, move.DstNodeID)
+				}
+				done(move, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the moves not started once a migration failed are no longer remaining
+	for _, move := range pending {
+		migrateprom.AddSlotsRemaining(m.opts.ClusterID, m.opts.ClusterName, move.SrcNodeID, move.DstNodeID, -1)
+	}
+
+	if firstErr == nil && len(skipped) > 0 {
+		return fmt.Errorf("%s", strings.Join(skipped, "; "))
+	}
+
+	return firstErr
+}
+
+// throttle waits until keys keys weighing bytes may be migrated
+func (m *Migrator) throttle(ctx context.Context, keys int, bytes int64) error {
+	if err := waitN(ctx, m.keysLimiter, int64(keys)); err != nil {
+		return err
+	}
+
+	return waitN(ctx, m.bytesLimiter, bytes)
+}
+
+// waitN waits for n tokens of limiter in burst sized chunks, WaitN refusing to wait for more than the burst at once.
+// A nil limiter doesn't wait.
+func waitN(ctx context.Context, limiter *rate.Limiter, n int64) error {
+	if limiter == nil {
+		return nil
+	}
+
+	burst := int64(limiter.Burst())
+	for n > 0 {
+		chunk := n
+		if chunk > burst {
+			chunk = burst
+		}
+		if err := limiter.WaitN(ctx, int(chunk)); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+
+	return nil
+}
+
+// needSizes tells whether the keys of a batch are measured before being migrated
+func (m *Migrator) needSizes() bool {
+	return m.bytesLimiter != nil || m.opts.BigKeyBytes > 0 || m.opts.BigKeyLength > 0
+}
+
+func (m *Migrator) isBigKey(size rh.KeySize) bool {
+	return (m.opts.BigKeyBytes > 0 && size.Bytes > m.opts.BigKeyBytes) ||
+		(m.opts.BigKeyLength > 0 && size.Length > m.opts.BigKeyLength)
+}
+
+// BigKeysError reports the big keys refused in a slot, see BigKeyPolicyRefuse
+type BigKeysError struct {
+	Slot int
+	Keys []rh.KeySize
+}
+
+func (e *BigKeysError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "slot %d holds %d big keys, left open, rerun with --big-key-policy %s to migrate them:", e.Slot, len(e.Keys), BigKeyPolicySeparate)
+	for _, size := range e.Keys {
+		fmt.Fprintf(&b, " key:%q type:%s bytes:%d length:%d;", size.Key, size.Type, size.Bytes, size.Length)
+	}
+	return b.String()
+}
@@ -0,0 +1,104 @@
+package migrate_slots
+
+import (
+	"context"
+	"fmt"
+
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+)
+
+// NewMasterClients connects to every master of nodes, the result is keyed by addr
+func NewMasterClients(ctx context.Context, nodes []*rh.ClusterNode) (map[string]*rh.Client, error) {
+	masterCliMap := make(map[string]*rh.Client, len(nodes))
+	for _, node := range nodes {
+		if !node.IsMaster() {
+			continue
+		}
+
+		cli, err := rh.NewNodeClient(ctx, node, conn_options.Options)
+		if err != nil {
+			CloseClients(masterCliMap)
+			return nil, fmt.Errorf("new client. addr:%s, err:%s", node.Addr, err)
+		}
+
+		masterCliMap[node.Addr] = cli
+	}
+
+	return masterCliMap, nil
+}
+
+func CloseClients(cliMap map[string]*rh.Client) {
+	for _, cli := range cliMap {
+		cli.Close()
+	}
+}
+
+// BuildPlan computes the moves needed for node to own every slot of specSlots,
+// with the key count of each slot taken from its current owner.
+func BuildPlan(ctx context.Context, addr string, masterCliMap map[string]*rh.Client, nodes []*rh.ClusterNode, node *rh.ClusterNode, specSlots rh.Slots) (*rh.MigrationPlan, error) {
+	var moves []rh.SlotMove
+
+	for slot := 0; slot < rh.TotalSlots; slot++ {
+		if !specSlots.IsSet(slot) || node.Slots.IsSet(slot) {
+			continue
+		}
+
+		// find a node which has this slot
+		var srcNode *rh.ClusterNode
+		for _, n := range nodes {
+			if n.IsMaster() && n.Slots.IsSet(slot) {
+				srcNode = n
+				break
+			}
+		}
+
+		if srcNode == nil {
+			return nil, fmt.Errorf("slot is not served by any master. slot:%d", slot)
+		}
+
+		moves = append(moves, rh.SlotMove{
+			Slot:      slot,
+			SrcNodeID: srcNode.ID,
+			SrcAddr:   srcNode.Addr,
+			DstNodeID: node.ID,
+			DstAddr:   node.Addr,
+		})
+	}
+
+	if err := CountPlanKeys(ctx, masterCliMap, moves); err != nil {
+		return nil, err
+	}
+
+	return rh.NewMigrationPlan(addr, nodes, moves), nil
+}
+
+// CountPlanKeys fills the KeyCount of every move with CLUSTER COUNTKEYSINSLOT on its source
+func CountPlanKeys(ctx context.Context, masterCliMap map[string]*rh.Client, moves []rh.SlotMove) error {
+	for i := range moves {
+		move := &moves[i]
+
+		srcCli, ok := masterCliMap[move.SrcAddr]
+		if !ok {
+			return fmt.Errorf("src addr not found. addr:%s", move.SrcAddr)
+		}
+
+		count, err := srcCli.ClusterCountKeysInSlot(ctx, move.Slot).Result()
+		if err != nil {
+			return fmt.Errorf("cluster count keys in slot. addr:%s, slot:%d, err:%s", move.SrcAddr, move.Slot, err)
+		}
+
+		move.KeyCount = count
+	}
+
+	return nil
+}
+
+func PrintPlan(plan *rh.MigrationPlan) {
+	for _, move := range plan.Moves {
+		fmt.Printf("slot:%d src_node_id:%s src_addr:%s dst_node_id:%s dst_addr:%s key_count:%d\n",
+			move.Slot, move.SrcNodeID, move.SrcAddr, move.DstNodeID, move.DstAddr, move.KeyCount)
+	}
+
+	fmt.Printf("plan: slots:%d key_count:%d topology:%s\n", len(plan.Moves), plan.KeyCount(), plan.Topology)
+}
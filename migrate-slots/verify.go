@@ -0,0 +1,126 @@
+package migrate_slots
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/go-redis/redis/v8"
+)
+
+// dumpFooterLen is the RDB version and CRC64 ending a DUMP payload, left out of the digest
+// so nodes of different versions encoding the value the same way agree
+const dumpFooterLen = 10
+
+// KeySample is the digest of the DUMP of a key taken before its slot is migrated
+type KeySample struct {
+	Key    string
+	Digest string
+	// Volatile keys have a TTL, they may be gone once migrated
+	Volatile bool
+}
+
+// SampleKeys digests the DUMP of up to n keys of slot
+func SampleKeys(ctx context.Context, cli *rh.Client, slot int, n int) ([]KeySample, error) {
+	keys, err := cli.ClusterGetKeysInSlot(ctx, slot, n).Result()
+	if err != nil {
+		return nil, fmt.Errorf("cluster get keys in slot. addr:%s, slot:%d, err:%s", cli.Addr, slot, err)
+	}
+
+	dumps, ttls, err := dumpKeys(ctx, cli, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []KeySample
+	for i, key := range keys {
+		// gone in the meantime
+		if dumps[i].Err() == redis.Nil {
+			continue
+		}
+
+		samples = append(samples, KeySample{Key: key, Digest: digest(dumps[i].Val()), Volatile: ttls[i].Val() > 0})
+	}
+
+	return samples, nil
+}
+
+func dumpKeys(ctx context.Context, cli *rh.Client, keys []string) ([]*redis.StringCmd, []*redis.DurationCmd, error) {
+	pip := cli.Pipeline()
+	dumps := make([]*redis.StringCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		dumps[i] = pip.Dump(ctx, key)
+		ttls[i] = pip.PTTL(ctx, key)
+	}
+
+	if _, err := pip.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, nil, fmt.Errorf("dump. addr:%s, err:%s", cli.Addr, err)
+	}
+
+	return dumps, ttls, nil
+}
+
+func digest(dump string) string {
+	if len(dump) > dumpFooterLen {
+		dump = dump[:len(dump)-dumpFooterLen]
+	}
+	sum := sha256.Sum256([]byte(dump))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifySlot checks the slot of move was migrated: the source holds no key of it, the destination
+// at least keyCount keys, and the samples taken before the migration exist on the destination with
+// the same DUMP. Keys written during the migration differ as well.
+func VerifySlot(ctx context.Context, srcCli, dstCli *rh.Client, move rh.SlotMove, keyCount int, samples []KeySample) error {
+	srcCount, err := srcCli.ClusterCountKeysInSlot(ctx, move.Slot).Result()
+	if err != nil {
+		return fmt.Errorf("cluster count keys in slot. addr:%s, slot:%d, err:%s", srcCli.Addr, move.Slot, err)
+	}
+
+	dstCount, err := dstCli.ClusterCountKeysInSlot(ctx, move.Slot).Result()
+	if err != nil {
+		return fmt.Errorf("cluster count keys in slot. addr:%s, slot:%d, err:%s", dstCli.Addr, move.Slot, err)
+	}
+
+	if srcCount != 0 {
+		return fmt.Errorf("verify slot %d: %d keys left on source %s", move.Slot, srcCount, srcCli.Addr)
+	}
+
+	// keys may expire once migrated, so only warn
+	if dstCount < int64(keyCount) {
+		fmt.Printf("verify slot warning. slot:%d, dst_addr:%s, dst_key_count:%d, migrated:%d\n", move.Slot, dstCli.Addr, dstCount, keyCount)
+	}
+
+	keys := make([]string, len(samples))
+	for i, sample := range samples {
+		keys[i] = sample.Key
+	}
+
+	dumps, _, err := dumpKeys(ctx, dstCli, keys)
+	if err != nil {
+		return err
+	}
+
+	var missing, mismatched []string
+	for i, sample := range samples {
+		switch {
+		case dumps[i].Err() == redis.Nil:
+			if !sample.Volatile {
+				missing = append(missing, sample.Key)
+			}
+		case digest(dumps[i].Val()) != sample.Digest:
+			mismatched = append(mismatched, sample.Key)
+		}
+	}
+
+	if len(missing) > 0 || len(mismatched) > 0 {
+		return fmt.Errorf("verify slot %d on %s: missing keys %q, keys with another value %q", move.Slot, dstCli.Addr, missing, mismatched)
+	}
+
+	fmt.Printf("verify slot success. slot:%d, dst_key_count:%d, samples:%d\n", move.Slot, dstCount, len(samples))
+
+	return nil
+}
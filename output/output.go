@@ -0,0 +1,52 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+)
+
+// AddFlag binds the --output flag of commands printing a report
+func AddFlag(fs *pflag.FlagSet, format *string) {
+	fs.StringVarP(format, "output", "o", FormatTable, "output format: table, json or yaml")
+}
+
+// Print writes v to stdout as json or yaml, the table format is left to table
+// which writes to a tabwriter flushed afterwards.
+func Print(format string, v interface{}, table func(w io.Writer)) error {
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(os.Stdout, string(data))
+		return err
+
+	case FormatYAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+
+	case FormatTable, "":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		table(w)
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown output format %s", format)
+}
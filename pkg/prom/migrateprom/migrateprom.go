@@ -0,0 +1,124 @@
+package migrateprom
+
+import (
+	"github.com/geesugar/redis-tools/pkg/prom"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var defaultMetrics *MigrateMetrics
+
+var labelNames = []string{"cluster_id", "cluster_name", "src_node_id", "dst_node_id"}
+
+// MigrateMetrics tracks the progress of slot migrations, labelled with the cluster and the source and destination node IDs
+type MigrateMetrics struct {
+	SlotsDoneCounter      *prometheus.CounterVec
+	SlotsRemainingGauge   *prometheus.GaugeVec
+	KeysMovedCounter      *prometheus.CounterVec
+	BytesMovedCounter     *prometheus.CounterVec
+	SlotDurationHistogram *prometheus.HistogramVec
+	ErrorsCounter         *prometheus.CounterVec
+}
+
+func init() {
+	defaultMetrics = NewMigrateCollector()
+	_ = metrics.Registry.Register(defaultMetrics.SlotsDoneCounter)
+	_ = metrics.Registry.Register(defaultMetrics.SlotsRemainingGauge)
+	_ = metrics.Registry.Register(defaultMetrics.KeysMovedCounter)
+	_ = metrics.Registry.Register(defaultMetrics.BytesMovedCounter)
+	_ = metrics.Registry.Register(defaultMetrics.SlotDurationHistogram)
+	_ = metrics.Registry.Register(defaultMetrics.ErrorsCounter)
+}
+
+func NewMigrateCollector(opts ...prom.Option) *MigrateMetrics {
+	options := prom.DefaultOptions()
+	options.Merge(opts...)
+
+	slotsDoneCounter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: options.Namespace,
+			Subsystem: options.Subsystem,
+			Name:      "migrate_slots_done_total",
+			Help:      "slots migrated and finalized",
+		}, labelNames,
+	)
+
+	slotsRemainingGauge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: options.Namespace,
+			Subsystem: options.Subsystem,
+			Name:      "migrate_slots_remaining",
+			Help:      "slots of the migration plan neither done nor failed yet",
+		}, labelNames,
+	)
+
+	keysMovedCounter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: options.Namespace,
+			Subsystem: options.Subsystem,
+			Name:      "migrate_keys_moved_total",
+			Help:      "keys moved by MIGRATE",
+		}, labelNames,
+	)
+
+	bytesMovedCounter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: options.Namespace,
+			Subsystem: options.Subsystem,
+			Name:      "migrate_bytes_moved_total",
+			Help:      "bytes moved by MIGRATE, estimated with MEMORY USAGE when the keys are measured",
+		}, labelNames,
+	)
+
+	slotDurationHistogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: options.Namespace,
+		Subsystem: options.Subsystem,
+		Name:      "migrate_slot_duration_seconds",
+		Help:      "duration of the migration of a slot",
+		Buckets:   []float64{.1, .5, 1, 5, 30, 60, 300, 900, 1800},
+	}, labelNames,
+	)
+
+	errorsCounter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: options.Namespace,
+			Subsystem: options.Subsystem,
+			Name:      "migrate_slot_errors_total",
+			Help:      "slot migrations failed",
+		}, labelNames,
+	)
+
+	return &MigrateMetrics{
+		SlotsDoneCounter:      slotsDoneCounter,
+		SlotsRemainingGauge:   slotsRemainingGauge,
+		KeysMovedCounter:      keysMovedCounter,
+		BytesMovedCounter:     bytesMovedCounter,
+		SlotDurationHistogram: slotDurationHistogram,
+		ErrorsCounter:         errorsCounter,
+	}
+}
+
+func AddSlotsRemaining(clusterID, clusterName, srcNodeID, dstNodeID string, slots int) {
+	defaultMetrics.SlotsRemainingGauge.WithLabelValues(clusterID, clusterName, srcNodeID, dstNodeID).Add(float64(slots))
+}
+
+// SetSlotDone counts a finalized, and verified if asked, slot, one less remaining, and observes its duration
+func SetSlotDone(clusterID, clusterName, srcNodeID, dstNodeID string, duration float64) {
+	defaultMetrics.SlotsDoneCounter.WithLabelValues(clusterID, clusterName, srcNodeID, dstNodeID).Inc()
+	defaultMetrics.SlotsRemainingGauge.WithLabelValues(clusterID, clusterName, srcNodeID, dstNodeID).Dec()
+	defaultMetrics.SlotDurationHistogram.WithLabelValues(clusterID, clusterName, srcNodeID, dstNodeID).Observe(duration)
+}
+
+func AddKeysMoved(clusterID, clusterName, srcNodeID, dstNodeID string, keys int) {
+	defaultMetrics.KeysMovedCounter.WithLabelValues(clusterID, clusterName, srcNodeID, dstNodeID).Add(float64(keys))
+}
+
+func AddBytesMoved(clusterID, clusterName, srcNodeID, dstNodeID string, bytes int64) {
+	defaultMetrics.BytesMovedCounter.WithLabelValues(clusterID, clusterName, srcNodeID, dstNodeID).Add(float64(bytes))
+}
+
+// IncErrors counts a failed slot, one less remaining
+func IncErrors(clusterID, clusterName, srcNodeID, dstNodeID string) {
+	defaultMetrics.ErrorsCounter.WithLabelValues(clusterID, clusterName, srcNodeID, dstNodeID).Inc()
+	defaultMetrics.SlotsRemainingGauge.WithLabelValues(clusterID, clusterName, srcNodeID, dstNodeID).Dec()
+}
@@ -6,6 +6,7 @@ type (
 		Namespace       string
 		Subsystem       string
 		DurationBuckets []float64
+		ConstLabels     map[string]string
 	}
 
 	Option func(*Options)
@@ -46,3 +47,11 @@ func WithDurationBuckets(buckets []float64) Option {
 		options.DurationBuckets = buckets
 	}
 }
+
+// WithConstLabels sets the constant labels of the metrics, like the addr of the node.
+// Metrics of the same name must share the same label names.
+func WithConstLabels(labels map[string]string) Option {
+	return func(options *Options) {
+		options.ConstLabels = labels
+	}
+}
@@ -2,6 +2,7 @@ package redisprom
 
 import (
 	"context"
+	"log"
 	"reflect"
 	"time"
 
@@ -11,45 +12,72 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
-var defaultHook = newHook()
-
 var labelNames = []string{"command", "error"}
 
-// NewHook creates a new go-redis hook instance and registers Prometheus collectors.
+// NewHook creates a go-redis hook exporting the metrics of commands and pipelines, with the
+// constant labels and buckets of opts. Hooks of the same constant labels share their collectors,
+// which keep the buckets of the first one.
+func NewHook(opts ...prom.Option) redis.Hook {
+	return newHook(opts...)
+}
+
+// Hook returns a hook without constant labels.
+//
+// Deprecated: use NewHook.
+func Hook() redis.Hook {
+	return NewHook()
+}
+
 func newHook(opts ...prom.Option) *redisHook {
 	options := prom.DefaultOptions()
 	options.Merge(opts...)
 
-	cmds := prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Namespace: options.Namespace,
-		Subsystem: options.Subsystem,
-		Name:      "commands_duration_seconds",
-		Help:      "Histogram of Redis commands",
-		Buckets:   options.DurationBuckets,
-	}, labelNames)
-
-	metrics.Registry.Register(cmds)
+	cmds := register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   options.Namespace,
+		Subsystem:   options.Subsystem,
+		Name:        "commands_duration_seconds",
+		Help:        "Histogram of Redis commands",
+		Buckets:     options.DurationBuckets,
+		ConstLabels: options.ConstLabels,
+	}, labelNames)).(*prometheus.HistogramVec)
+
+	pipelines := register(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   options.Namespace,
+		Subsystem:   options.Subsystem,
+		Name:        "pipelines_duration_seconds",
+		Help:        "Histogram of Redis pipelines",
+		Buckets:     options.DurationBuckets,
+		ConstLabels: options.ConstLabels,
+	}, []string{"error"})).(*prometheus.HistogramVec)
+
+	pipelinedCmds := register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   options.Namespace,
+		Subsystem:   options.Subsystem,
+		Name:        "pipelined_commands_total",
+		Help:        "Number of Redis commands sent in pipelines",
+		ConstLabels: options.ConstLabels,
+	}, labelNames)).(*prometheus.CounterVec)
 
 	return &redisHook{
-		options:  options,
-		commands: cmds,
+		options:       options,
+		commands:      cmds,
+		pipelines:     pipelines,
+		pipelinedCmds: pipelinedCmds,
 	}
 }
 
 type (
 	// redisHook represents a go-redis hook that exports metrics of commands and pipelines.
 	redisHook struct {
-		options  *prom.Options
-		commands *prometheus.HistogramVec
+		options       *prom.Options
+		commands      *prometheus.HistogramVec
+		pipelines     *prometheus.HistogramVec
+		pipelinedCmds *prometheus.CounterVec
 	}
 
 	startKey struct{}
 )
 
-func Hook() redis.Hook {
-	return defaultHook
-}
-
 func (hook *redisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
 	return context.WithValue(ctx, startKey{}, time.Now()), nil
 }
@@ -60,12 +88,7 @@ func (hook *redisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error
 		duration = time.Since(start).Seconds()
 	}
 
-	errstr := ""
-	if cmd.Err() != nil {
-		errstr = reflect.TypeOf(cmd.Err()).String()
-	}
-
-	hook.commands.WithLabelValues(cmd.Name(), errstr).Observe(duration)
+	hook.commands.WithLabelValues(cmd.Name(), errorLabel(cmd.Err())).Observe(duration)
 
 	return nil
 }
@@ -74,28 +97,40 @@ func (hook *redisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.C
 	return context.WithValue(ctx, startKey{}, time.Now()), nil
 }
 
+// AfterProcessPipeline observes the duration of the whole pipeline once, and counts its commands,
+// their own duration being unknown
 func (hook *redisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
 	duration := float64(0)
 	if start, ok := ctx.Value(startKey{}).(time.Time); ok {
 		duration = time.Since(start).Seconds()
 	}
 
-	hook.commands.WithLabelValues("pipline", "").Observe(duration)
-
+	pipelineErr := ""
 	for _, cmd := range cmds {
-		cmderrstr := ""
-		if cmd.Err() != nil {
-			cmderrstr = reflect.TypeOf(cmd.Err()).String()
+		errstr := errorLabel(cmd.Err())
+		if pipelineErr == "" {
+			pipelineErr = errstr
 		}
 
-		hook.commands.WithLabelValues(cmd.Name(), cmderrstr).Observe(duration)
+		hook.pipelinedCmds.WithLabelValues(cmd.Name(), errstr).Inc()
 	}
 
+	hook.pipelines.WithLabelValues(pipelineErr).Observe(duration)
+
 	return nil
 }
 
+func errorLabel(err error) string {
+	if err == nil {
+		return ""
+	}
+	return reflect.TypeOf(err).String()
+}
+
+// register registers collector, or returns the collector already registered with the same
+// descriptors. A collector conflicting with another one is logged and left unregistered.
 func register(collector prometheus.Collector) prometheus.Collector {
-	err := prometheus.Register(collector)
+	err := metrics.Registry.Register(collector)
 	if err == nil {
 		return collector
 	}
@@ -104,5 +139,6 @@ func register(collector prometheus.Collector) prometheus.Collector {
 		return arErr.ExistingCollector
 	}
 
-	panic(err)
+	log.Printf("register redis metrics error: %s", err)
+	return collector
 }
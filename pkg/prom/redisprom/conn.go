@@ -1,6 +1,8 @@
 package redisprom
 
 import (
+	"sync"
+
 	"github.com/go-redis/redis/v8"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -10,10 +12,12 @@ type StatGetter interface {
 	PoolStats() *redis.PoolStats
 }
 
-// Collector collects statistics from a redis client.
+// Collector collects the statistics summed over the pools of its clients.
 // It implements the prometheus.Collector interface.
 type Collector struct {
-	getter      StatGetter
+	mu      sync.Mutex
+	getters []StatGetter
+
 	hitDesc     *prometheus.Desc
 	missDesc    *prometheus.Desc
 	timeoutDesc *prometheus.Desc
@@ -35,37 +39,44 @@ var _ prometheus.Collector = (*Collector)(nil)
 //   - pool_conn_idle_current
 //   - pool_conn_stale_total
 func NewCollector(namespace, subsystem string, getter StatGetter) *Collector {
+	collector := NewCollectorWithLabels(namespace, subsystem, nil)
+	collector.Add(getter)
+	return collector
+}
+
+// NewCollectorWithLabels returns a Collector without client, whose metrics carry constLabels.
+// Clients are added and removed as they are created and closed.
+func NewCollectorWithLabels(namespace, subsystem string, constLabels prometheus.Labels) *Collector {
 	return &Collector{
-		getter: getter,
 		hitDesc: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, subsystem, "pool_hit_total"),
 			"Number of times a connection was found in the pool",
-			nil, nil,
+			nil, constLabels,
 		),
 		missDesc: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, subsystem, "pool_miss_total"),
 			"Number of times a connection was not found in the pool",
-			nil, nil,
+			nil, constLabels,
 		),
 		timeoutDesc: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, subsystem, "pool_timeout_total"),
 			"Number of times a timeout occurred when looking for a connection in the pool",
-			nil, nil,
+			nil, constLabels,
 		),
 		totalDesc: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, subsystem, "pool_conn_total_current"),
 			"Current number of connections in the pool",
-			nil, nil,
+			nil, constLabels,
 		),
 		idleDesc: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, subsystem, "pool_conn_idle_current"),
 			"Current number of idle connections in the pool",
-			nil, nil,
+			nil, constLabels,
 		),
 		staleDesc: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, subsystem, "pool_conn_stale_total"),
 			"Number of times a connection was removed from the pool because it was stale",
-			nil, nil,
+			nil, constLabels,
 		),
 	}
 }
@@ -80,9 +91,50 @@ func (s *Collector) Describe(descs chan<- *prometheus.Desc) {
 	descs <- s.staleDesc
 }
 
+// Add adds the pool statistics of getter to the collected ones
+func (s *Collector) Add(getter StatGetter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.getters = append(s.getters, getter)
+}
+
+// Remove removes getter, typically once its client is closed, and returns the count of the remaining ones
+func (s *Collector) Remove(getter StatGetter) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, g := range s.getters {
+		if g == getter {
+			s.getters = append(s.getters[:i], s.getters[i+1:]...)
+			break
+		}
+	}
+
+	return len(s.getters)
+}
+
+func (s *Collector) poolStats() *redis.PoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := &redis.PoolStats{}
+	for _, getter := range s.getters {
+		st := getter.PoolStats()
+		stats.Hits += st.Hits
+		stats.Misses += st.Misses
+		stats.Timeouts += st.Timeouts
+		stats.TotalConns += st.TotalConns
+		stats.IdleConns += st.IdleConns
+		stats.StaleConns += st.StaleConns
+	}
+
+	return stats
+}
+
 // Collect implements the prometheus.Collector interface.
 func (s *Collector) Collect(metrics chan<- prometheus.Metric) {
-	stats := s.getter.PoolStats()
+	stats := s.poolStats()
 	metrics <- prometheus.MustNewConstMetric(
 		s.hitDesc,
 		prometheus.CounterValue,
@@ -24,6 +24,7 @@ type RuntimeMetrics struct {
 	SlotsIsBalanceGauge       *prometheus.GaugeVec
 	OpenSlotsGauge            *prometheus.GaugeVec
 	ResourceStatusGauge       *prometheus.GaugeVec
+	CheckProblemsGauge        *prometheus.GaugeVec
 }
 
 func init() {
@@ -34,6 +35,7 @@ func init() {
 	_ = metrics.Registry.Register(defaultMetrics.SlotsIsBalanceGauge)
 	_ = metrics.Registry.Register(defaultMetrics.OpenSlotsGauge)
 	_ = metrics.Registry.Register(defaultMetrics.ResourceStatusGauge)
+	_ = metrics.Registry.Register(defaultMetrics.CheckProblemsGauge)
 	//defaultMetrics.registerAll()
 }
 
@@ -104,6 +106,15 @@ func NewRuntimeCollector(opts ...prom.Option) *RuntimeMetrics {
 		}, []string{"cluster_id", "cluster_name", "resource"},
 	)
 
+	checkProblemsGauge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: options.Namespace,
+			Subsystem: options.Subsystem,
+			Name:      "check_problems",
+			Help:      "problems found by each check of the cluster, -1 when the check could not run",
+		}, []string{"cluster_id", "cluster_name", "check"},
+	)
+
 	return &RuntimeMetrics{
 		ConsistencyCheckGauge:     consistencyCheckGauge,
 		ConsistencyCheckHistogram: consistencyCheckHistogram,
@@ -111,6 +122,7 @@ func NewRuntimeCollector(opts ...prom.Option) *RuntimeMetrics {
 		SlotsIsBalanceGauge:       slotsIsBalanceGauge,
 		OpenSlotsGauge:            openSlots,
 		ResourceStatusGauge:       resourceStatusGauge,
+		CheckProblemsGauge:        checkProblemsGauge,
 	}
 }
 
@@ -127,15 +139,22 @@ func SetSlotsIsBalanceMetrics(clusterID, clusterName string, isBalance int) {
 	defaultMetrics.SlotsIsBalanceGauge.WithLabelValues(clusterID, clusterName).Set(float64(isBalance))
 }
 
+// SetOpenSlotsMetrics replaces the open slots of the cluster, the series of the previous open slots are dropped
 func SetOpenSlotsMetrics(clusterID, clusterName string, openSlots string) {
 	value := 0
 	if openSlots != "" {
 		value = 1
 	}
 
+	defaultMetrics.OpenSlotsGauge.DeletePartialMatch(prometheus.Labels{"cluster_id": clusterID, "cluster_name": clusterName})
+
 	defaultMetrics.OpenSlotsGauge.WithLabelValues(clusterID, clusterName, openSlots).Set(float64(value))
 }
 
 func SetResourceGaugeMetrics(clusterID, clusterName string, resource Resource, value int64) {
 	defaultMetrics.ResourceStatusGauge.WithLabelValues(clusterID, clusterName, string(resource)).Set(float64(value))
 }
+
+func SetCheckProblemsMetrics(clusterID, clusterName string, check string, problems int) {
+	defaultMetrics.CheckProblemsGauge.WithLabelValues(clusterID, clusterName, check).Set(float64(problems))
+}
@@ -0,0 +1,87 @@
+package rh
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// KeySize is the size of a key, Bytes from MEMORY USAGE and Length from the length command of its type.
+// Keys gone in the meantime have the type none.
+type KeySize struct {
+	Key    string `json:"key"`
+	Type   string `json:"type"`
+	Bytes  int64  `json:"bytes"`
+	Length int64  `json:"length"`
+}
+
+// KeySizes pipelines MEMORY USAGE and TYPE for keys, and with withLength
+// STRLEN, LLEN, HLEN, SCARD, ZCARD or XLEN depending on the type
+func (c *Client) KeySizes(ctx context.Context, keys []string, withLength bool) ([]KeySize, error) {
+	pip := c.Pipeline()
+	usageCmds := make([]*redis.IntCmd, len(keys))
+	typeCmds := make([]*redis.StatusCmd, len(keys))
+	for i, key := range keys {
+		usageCmds[i] = pip.MemoryUsage(ctx, key)
+		typeCmds[i] = pip.Type(ctx, key)
+	}
+
+	// keys expired in the meantime answer nil to MEMORY USAGE
+	if _, err := pip.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("memory usage. addr:%s, err:%s", c.Addr, err)
+	}
+
+	sizes := make([]KeySize, len(keys))
+	for i, key := range keys {
+		sizes[i] = KeySize{Key: key, Type: typeCmds[i].Val(), Bytes: usageCmds[i].Val()}
+	}
+
+	if !withLength {
+		return sizes, nil
+	}
+
+	pip = c.Pipeline()
+	lengthCmds := make([]*redis.IntCmd, len(keys))
+	for i, size := range sizes {
+		switch size.Type {
+		case "string":
+			lengthCmds[i] = pip.StrLen(ctx, size.Key)
+		case "list":
+			lengthCmds[i] = pip.LLen(ctx, size.Key)
+		case "hash":
+			lengthCmds[i] = pip.HLen(ctx, size.Key)
+		case "set":
+			lengthCmds[i] = pip.SCard(ctx, size.Key)
+		case "zset":
+			lengthCmds[i] = pip.ZCard(ctx, size.Key)
+		case "stream":
+			lengthCmds[i] = pip.XLen(ctx, size.Key)
+		}
+	}
+
+	// a key replaced by another type in the meantime answers WRONGTYPE, its length stays 0
+	if _, err := pip.Exec(ctx); err != nil {
+		if _, ok := err.(redis.Error); !ok {
+			return nil, fmt.Errorf("key length. addr:%s, err:%s", c.Addr, err)
+		}
+	}
+
+	for i, cmd := range lengthCmds {
+		if cmd != nil {
+			sizes[i].Length = cmd.Val()
+		}
+	}
+
+	return sizes, nil
+}
+
+// WithReadTimeout returns a client sharing the connections of c which waits up to timeout for a reply,
+// for commands like MIGRATE whose reply may take longer than the read timeout of c
+func (c *Client) WithReadTimeout(timeout time.Duration) redis.UniversalClient {
+	if cli, ok := c.UniversalClient.(*redis.Client); ok {
+		return cli.WithTimeout(timeout)
+	}
+	return c.UniversalClient
+}
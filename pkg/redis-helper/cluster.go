@@ -8,16 +8,34 @@ import (
 )
 
 type ClusterNode struct {
-	ID        string // this is node ID
-	Addr      string
-	Role      Role
-	State     State
-	Myself    bool
-	SlotsStr  string
-	Slots     Slots
-	MasterID  string
+	ID string // this is node ID
+	// Addr is host:port, the host bracketed if IPv6
+	Addr    string
+	Host    string
+	Port    uint64
+	BusPort uint64
+	// Hostname is announced by redis 7 with cluster-announce-hostname
+	Hostname string
+	// Aux are the key=value fields following the hostname since redis 7.2, like shard-id
+	Aux        map[string]string
+	Flags      []string
+	Role       Role
+	State      State
+	Myself     bool
+	NoFailover bool
+	SlotsStr   string
+	Slots      Slots
+	MasterID   string
+	// PingSent and PongRecv are unix times in milliseconds, PingSent is 0 without pending ping
+	PingSent  int64
+	PongRecv  int64
+	LinkState string
 	Connected bool
 	Epoch     int64
+	// Migrating maps slot to the destination node ID, only filled for the myself line
+	Migrating map[int]string
+	// Importing maps slot to the source node ID, only filled for the myself line
+	Importing map[int]string
 }
 
 type Role int
@@ -38,6 +56,37 @@ const (
 	StateHandshake
 )
 
+func (r Role) String() string {
+	switch r {
+	case RoleMaster:
+		return "master"
+	case RoleSlave:
+		return "slave"
+	}
+	return "none"
+}
+
+func (s State) String() string {
+	if s == StateNormal {
+		return "normal"
+	}
+
+	var flags []string
+	if s&StatePFail > 0 {
+		flags = append(flags, "fail?")
+	}
+	if s&StateFail > 0 {
+		flags = append(flags, "fail")
+	}
+	if s&StateNoAddr > 0 {
+		flags = append(flags, "noaddr")
+	}
+	if s&StateHandshake > 0 {
+		flags = append(flags, "handshake")
+	}
+	return strings.Join(flags, ",")
+}
+
 func (p *ClusterNode) IsNoAddr() bool { return p.State&StateNoAddr > 0 }
 func (p *ClusterNode) IsMaster() bool { return p.Role == RoleMaster }
 func (p *ClusterNode) IsSlave() bool  { return p.Role == RoleSlave }
@@ -45,9 +94,14 @@ func (p *ClusterNode) IsOK() bool {
 	return p.State == StateNormal && (p.Role == RoleSlave || p.Role == RoleMaster)
 }
 
+// HasOpenSlots returns whether the node has slots in importing or migrating state
+func (p *ClusterNode) HasOpenSlots() bool { return len(p.Migrating) > 0 || len(p.Importing) > 0 }
+
 // IsHealthy returns whether the cluster is healthy
 func (p *ClusterNode) IsHealthy() bool { return p.State == StateNormal }
 
+// CheckEqual compares the topology of two views of the same node: ID, addr, role, master ID, config epoch and slots.
+// The flags, link state and open slots depend on the observer and are not compared.
 func (p *ClusterNode) CheckEqual(other *ClusterNode) error {
 	if other == nil {
 		return fmt.Errorf("invalid cluster node")
@@ -62,21 +116,15 @@ func (p *ClusterNode) CheckEqual(other *ClusterNode) error {
 	if p.Role != other.Role {
 		return fmt.Errorf("role not the same(%v, %v)", p.Role, other.Role)
 	}
-	if p.State != other.State {
-		return fmt.Errorf("state not the same(%v, %v)", p.State, other.State)
-	}
 	if p.MasterID != other.MasterID {
 		return fmt.Errorf("MasterID not the same(%v, %v)", p.MasterID, other.MasterID)
 	}
-	if p.Connected != other.Connected {
-		return fmt.Errorf("connected not the same(%v, %v)", p.Connected, other.Connected)
-	}
 	// if it was slave, the config epoch came from its master
 	if p.IsMaster() && p.Epoch != other.Epoch {
 		return fmt.Errorf("epoch not the same(%v, %v)", p.Epoch, other.Epoch)
 	}
-	if p.SlotsStr != other.SlotsStr {
-		return fmt.Errorf("SlotSlice not the same(%v, %v)", p.SlotsStr, other.SlotsStr)
+	if !p.Slots.Equal(other.Slots) {
+		return fmt.Errorf("slots not the same(%v, %v)", p.Slots, other.Slots)
 	}
 
 	return nil
@@ -86,123 +134,237 @@ const (
 	ClusterSlots = 16384
 )
 
+// ParseClusterNodes parses the reply of CLUSTER NODES, a malformed line is an error
 func ParseClusterNodes(s string) (nodes []*ClusterNode, err error) {
 	l := strings.Split(s, "\n")
 	nodes = make([]*ClusterNode, 0, len(l))
 
 	for _, line := range l {
+		line = strings.TrimSuffix(line, "\r")
 		if len(line) == 0 {
 			continue
 		}
 
-		rs := strings.SplitN(line, " ", 9)
-		// slave didnt contain slot info
-		// nolint
-		if len(rs) < 8 {
-			continue
+		node, err := parseClusterNode(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cluster node %q: %s", line, err)
 		}
 
-		addrs := strings.SplitN(rs[1], "@", 2)
-		// nolint
-		if len(addrs) != 2 {
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// parseClusterNode parses
+// <id> <ip:port@cport[,hostname[,key=value...]]> <flags> <master> <ping-sent> <pong-recv> <config-epoch> <link-state> <slot>...
+func parseClusterNode(line string) (*ClusterNode, error) {
+	rs := strings.Split(line, " ")
+	if len(rs) < 8 {
+		return nil, fmt.Errorf("%d fields, expect at least 8", len(rs))
+	}
+
+	node := &ClusterNode{ID: rs[0], MasterID: rs[3], LinkState: rs[7]}
+
+	if !isNodeID(node.ID) {
+		return nil, fmt.Errorf("invalid node id %s", node.ID)
+	}
+	if node.MasterID != "-" && !isNodeID(node.MasterID) {
+		return nil, fmt.Errorf("invalid master id %s", node.MasterID)
+	}
+
+	if err := node.parseAddr(rs[1]); err != nil {
+		return nil, err
+	}
+
+	if err := node.parseFlags(rs[2]); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if node.PingSent, err = strconv.ParseInt(rs[4], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid ping-sent %s", rs[4])
+	}
+	if node.PongRecv, err = strconv.ParseInt(rs[5], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid pong-recv %s", rs[5])
+	}
+	if node.Epoch, err = strconv.ParseInt(rs[6], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid config-epoch %s", rs[6])
+	}
+
+	switch node.LinkState {
+	case "connected":
+		node.Connected = true
+	case "disconnected":
+	default:
+		return nil, fmt.Errorf("invalid link-state %s", node.LinkState)
+	}
+
+	node.Slots = NewSlots()
+	node.Migrating = map[int]string{}
+	node.Importing = map[int]string{}
+
+	var slotSlices []string
+	for _, field := range rs[8:] {
+		if strings.HasPrefix(field, "[") {
+			if err := parseOpenSlot(field, node.Migrating, node.Importing); err != nil {
+				return nil, err
+			}
 			continue
 		}
 
-		stats := strings.Split(rs[2], ",")
-
-		role := RoleNone
-		myselfFlag := false
-		state := StateNormal
-		connected := false
-
-		for _, stat := range stats {
-			switch stat {
-			case "master":
-				role = RoleMaster
-			case "slave":
-				role = RoleSlave
-
-			case "myself":
-				myselfFlag = true
-			case "fail?":
-				state |= StatePFail
-			case "fail":
-				state |= StateFail
-			case "noaddr":
-				state |= StateNoAddr
-			case "handshake":
-				state |= StateHandshake
-			}
+		if err := node.Slots.SetSlotSlice(field); err != nil {
+			return nil, err
 		}
+		slotSlices = append(slotSlices, field)
+	}
+	node.SlotsStr = strings.Join(slotSlices, " ")
+
+	return node, nil
+}
+
+// parseAddr parses ip:port@cport[,hostname[,key=value...]], the bus port is missing before redis 4
+func (p *ClusterNode) parseAddr(field string) error {
+	parts := strings.Split(field, ",")
 
-		epoch, err := strconv.ParseInt(rs[6], 10, 64)
+	addr := parts[0]
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		busPort, err := ParsePort(addr[i+1:])
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("invalid bus port in %s", field)
 		}
+		p.BusPort = busPort
+		addr = addr[:i]
+	}
+
+	host, port, err := ParseAddr(addr)
+	if err != nil {
+		return err
+	}
+	p.Host, p.Port, p.Addr = host, port, JoinAddr(host, port)
+
+	if len(parts) > 1 {
+		p.Hostname = parts[1]
+	}
 
-		if rs[7] == "connected" {
-			connected = true
+	for _, aux := range parts[min(len(parts), 2):] {
+		kv := strings.SplitN(aux, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid aux field %s", aux)
+		}
+		if p.Aux == nil {
+			p.Aux = make(map[string]string)
 		}
+		p.Aux[kv[0]] = kv[1]
+	}
 
-		slotsStr := ""
-		// nolint
-		if len(rs) >= 9 {
-			l := strings.SplitN(rs[8], "[", 2)
-			slotsStr = strings.Trim(l[0], " ")
+	return nil
+}
+
+func (p *ClusterNode) parseFlags(field string) error {
+	p.Flags = strings.Split(field, ",")
+
+	for _, flag := range p.Flags {
+		switch flag {
+		case "master":
+			p.Role = RoleMaster
+		case "slave":
+			p.Role = RoleSlave
+		case "myself":
+			p.Myself = true
+		case "fail?":
+			p.State |= StatePFail
+		case "fail":
+			p.State |= StateFail
+		case "noaddr":
+			p.State |= StateNoAddr
+		case "handshake":
+			p.State |= StateHandshake
+		case "nofailover":
+			p.NoFailover = true
+		case "noflags":
+		case "":
+			return fmt.Errorf("empty flag in %s", field)
 		}
+	}
 
-		slots := NewSlots()
-		for _, slotSlice := range strings.Split(slotsStr, " ") {
-			err = slots.SetSlotSlice(slotSlice)
-			if err != nil {
-				return nil, err
-			}
+	return nil
+}
+
+func isNodeID(id string) bool {
+	if len(id) != 40 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
 		}
+	}
+	return true
+}
 
-		nodes = append(nodes, &ClusterNode{
-			ID:        rs[0],
-			Addr:      addrs[0],
-			Role:      role,
-			Myself:    myselfFlag,
-			State:     state,
-			MasterID:  rs[3],
-			Connected: connected,
-			SlotsStr:  slotsStr,
-			Slots:     slots,
-			Epoch:     epoch,
-		})
-	}
-
-	// to have a final check for the all slots was parsed right
-	//if totalSlotsNum != ClusterSlots {
-	//	return nodes, false, fmt.Errorf("slots is not ok")
-	//}
+// parseOpenSlot parses [slot->-nodeid] (migrating) and [slot-<-nodeid] (importing)
+func parseOpenSlot(field string, migrating, importing map[int]string) error {
+	s := strings.TrimSuffix(strings.TrimPrefix(field, "["), "]")
 
-	return nodes, nil
+	open := migrating
+	kv := strings.SplitN(s, "->-", 2)
+	if len(kv) != 2 {
+		open = importing
+		kv = strings.SplitN(s, "-<-", 2)
+	}
+	if len(kv) != 2 {
+		return fmt.Errorf("invalid open slot %s", field)
+	}
+
+	slot, err := strconv.Atoi(kv[0])
+	if err != nil {
+		return fmt.Errorf("invalid open slot %s", field)
+	}
+
+	open[slot] = kv[1]
+	return nil
 }
 
+// ParseClusterInfo parses the reply of CLUSTER INFO, the cluster_stats_messages_<type>_sent and
+// _received counters go to MessagesSent and MessagesReceived by type, unknown fields are ignored
+// and fields which do not parse are left zero
 func ParseClusterInfo(s string) (info *ClusterInfo, err error) {
-	l := strings.Split(s, "\n")
+	fields := make(map[string]string)
+	info = &ClusterInfo{
+		MessagesSent:     make(map[string]int64),
+		MessagesReceived: make(map[string]int64),
+	}
 
-	info = &ClusterInfo{}
-	for _, line := range l {
-		if len(line) == 0 {
+	for _, line := range strings.Split(s, "\n") {
+		kv := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(kv) != 2 {
 			continue
 		}
-		kv := strings.Split(line, ":")
-		if len(kv) != 2 {
+
+		key, value := kv[0], kv[1]
+		if !strings.HasPrefix(key, "cluster_stats_messages_") || key == "cluster_stats_messages_sent" || key == "cluster_stats_messages_received" {
+			fields[key] = value
 			continue
 		}
-		switch kv[0] {
-		case "cluster_my_epoch":
-			val, err := strconv.Atoi(kv[1])
-			if err != nil {
-				return nil, fmt.Errorf("invalid cluster_my_epoch")
-			}
-			info.MyEpoch = val
+
+		counters := info.MessagesSent
+		typ := strings.TrimSuffix(strings.TrimPrefix(key, "cluster_stats_messages_"), "_sent")
+		if strings.HasSuffix(key, "_received") {
+			counters = info.MessagesReceived
+			typ = strings.TrimSuffix(strings.TrimPrefix(key, "cluster_stats_messages_"), "_received")
 		}
+
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			logInvalidInfoField(key, value)
+			continue
+		}
+		counters[typ] = n
 	}
 
+	setInfoFields(info, fields)
+
 	return info, nil
 }
 
@@ -215,13 +377,33 @@ func ExtractMyself(nodes []*ClusterNode) *ClusterNode {
 	return nil
 }
 
+// ClusterInfo is the reply of CLUSTER INFO, the fields are set from the keys of their info tag
 type ClusterInfo struct {
-	ID      string // this is node ID
-	MyEpoch int
+	ID            string `json:"id"` // this is node ID
+	State         string `info:"cluster_state" json:"state"`
+	SlotsAssigned int64  `info:"cluster_slots_assigned" json:"slots_assigned"`
+	SlotsOK       int64  `info:"cluster_slots_ok" json:"slots_ok"`
+	SlotsPFail    int64  `info:"cluster_slots_pfail" json:"slots_pfail"`
+	SlotsFail     int64  `info:"cluster_slots_fail" json:"slots_fail"`
+	KnownNodes    int64  `info:"cluster_known_nodes" json:"known_nodes"`
+	Size          int64  `info:"cluster_size" json:"size"`
+	CurrentEpoch  int64  `info:"cluster_current_epoch" json:"current_epoch"`
+	MyEpoch       int64  `info:"cluster_my_epoch" json:"my_epoch"`
+	// TotalMessagesSent and TotalMessagesReceived sum the messages of every type
+	TotalMessagesSent     int64 `info:"cluster_stats_messages_sent" json:"total_messages_sent"`
+	TotalMessagesReceived int64 `info:"cluster_stats_messages_received" json:"total_messages_received"`
+	// MessagesSent and MessagesReceived count the messages by type: ping, pong, meet, fail, publish, update...
+	MessagesSent     map[string]int64 `json:"messages_sent"`
+	MessagesReceived map[string]int64 `json:"messages_received"`
+}
+
+// IsOK tells whether the node sees the cluster state ok
+func (info *ClusterInfo) IsOK() bool {
+	return info.State == "ok"
 }
 
-func GetClusterNodes(ctx context.Context, addr string) ([]*ClusterNode, error) {
-	cli, err := NewClient(ctx, addr, "", "")
+func GetClusterNodes(ctx context.Context, addr string, opts *ConnOptions) ([]*ClusterNode, error) {
+	cli, err := NewClientWithOptions(ctx, addr, opts)
 	if err != nil {
 		return nil, fmt.Errorf("new client. addr:%s, err:%s", addr, err)
 	}
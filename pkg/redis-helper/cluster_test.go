@@ -0,0 +1,302 @@
+package rh
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testID1 = "07c37dfeb235213a872192d90877d0cd55635b91"
+	testID2 = "67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1"
+	testID3 = "e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca"
+)
+
+func TestParseAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		host    string
+		port    uint64
+		joined  string
+		invalid bool
+	}{
+		{addr: "127.0.0.1:6379", host: "127.0.0.1", port: 6379, joined: "127.0.0.1:6379"},
+		{addr: "redis-0.redis:6379", host: "redis-0.redis", port: 6379, joined: "redis-0.redis:6379"},
+		{addr: "[::1]:6379", host: "::1", port: 6379, joined: "[::1]:6379"},
+		// CLUSTER NODES prints IPv6 hosts without brackets
+		{addr: "2001:db8::1:7000", host: "2001:db8::1", port: 7000, joined: "[2001:db8::1]:7000"},
+		{addr: ":0", host: "", port: 0, joined: ":0"},
+		{addr: "127.0.0.1", invalid: true},
+		{addr: "127.0.0.1:", invalid: true},
+		{addr: "127.0.0.1:65536", invalid: true},
+		{addr: "127.0.0.1:port", invalid: true},
+		{addr: "[::1:6379", invalid: true},
+	}
+
+	for _, tt := range tests {
+		host, port, err := ParseAddr(tt.addr)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("ParseAddr(%q) = %q, %d, want an error", tt.addr, host, port)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAddr(%q) error: %s", tt.addr, err)
+			continue
+		}
+
+		if host != tt.host || port != tt.port {
+			t.Errorf("ParseAddr(%q) = %q, %d, want %q, %d", tt.addr, host, port, tt.host, tt.port)
+		}
+		if joined := JoinAddr(host, port); joined != tt.joined {
+			t.Errorf("JoinAddr(%q, %d) = %q, want %q", host, port, joined, tt.joined)
+		}
+	}
+}
+
+func TestParseClusterNode(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want *ClusterNode
+	}{
+		{
+			name: "master",
+			line: testID1 + " 127.0.0.1:30001@31001 myself,master - 0 1426238317000 1 connected 0-5460",
+			want: &ClusterNode{
+				ID: testID1, Addr: "127.0.0.1:30001", Host: "127.0.0.1", Port: 30001, BusPort: 31001,
+				Flags: []string{"myself", "master"}, Role: RoleMaster, Myself: true,
+				SlotsStr: "0-5460", MasterID: "-", PongRecv: 1426238317000, LinkState: "connected", Connected: true, Epoch: 1,
+			},
+		},
+		{
+			name: "replica",
+			line: testID2 + " 127.0.0.1:30004@31004 slave " + testID1 + " 1426238316232 1426238318243 1 disconnected",
+			want: &ClusterNode{
+				ID: testID2, Addr: "127.0.0.1:30004", Host: "127.0.0.1", Port: 30004, BusPort: 31004,
+				Flags: []string{"slave"}, Role: RoleSlave,
+				MasterID: testID1, PingSent: 1426238316232, PongRecv: 1426238318243, LinkState: "disconnected", Epoch: 1,
+			},
+		},
+		{
+			name: "IPv6",
+			line: testID1 + " 2001:db8::1:7000@17000 master,nofailover - 0 0 3 connected 100 200-300",
+			want: &ClusterNode{
+				ID: testID1, Addr: "[2001:db8::1]:7000", Host: "2001:db8::1", Port: 7000, BusPort: 17000,
+				Flags: []string{"master", "nofailover"}, Role: RoleMaster, NoFailover: true,
+				SlotsStr: "100 200-300", MasterID: "-", LinkState: "connected", Connected: true, Epoch: 3,
+			},
+		},
+		{
+			name: "hostname and aux fields",
+			line: testID1 + " 10.0.0.1:6379@16379,redis-0.redis,shard-id=abc,tls-port=0 master - 0 0 2 connected",
+			want: &ClusterNode{
+				ID: testID1, Addr: "10.0.0.1:6379", Host: "10.0.0.1", Port: 6379, BusPort: 16379,
+				Hostname: "redis-0.redis", Aux: map[string]string{"shard-id": "abc", "tls-port": "0"},
+				Flags: []string{"master"}, Role: RoleMaster,
+				MasterID: "-", LinkState: "connected", Connected: true, Epoch: 2,
+			},
+		},
+		{
+			name: "empty hostname",
+			line: testID1 + " 10.0.0.1:6379@16379, master - 0 0 2 connected",
+			want: &ClusterNode{
+				ID: testID1, Addr: "10.0.0.1:6379", Host: "10.0.0.1", Port: 6379, BusPort: 16379,
+				Flags: []string{"master"}, Role: RoleMaster,
+				MasterID: "-", LinkState: "connected", Connected: true, Epoch: 2,
+			},
+		},
+		{
+			name: "no bus port",
+			line: testID1 + " 127.0.0.1:30001 master - 0 0 1 connected",
+			want: &ClusterNode{
+				ID: testID1, Addr: "127.0.0.1:30001", Host: "127.0.0.1", Port: 30001,
+				Flags: []string{"master"}, Role: RoleMaster,
+				MasterID: "-", LinkState: "connected", Connected: true, Epoch: 1,
+			},
+		},
+		{
+			name: "noaddr",
+			line: testID3 + " :0@0 master,fail,noaddr - 1426238316232 1426238316232 4 disconnected",
+			want: &ClusterNode{
+				ID: testID3, Addr: ":0",
+				Flags: []string{"master", "fail", "noaddr"}, Role: RoleMaster, State: StateFail | StateNoAddr,
+				MasterID: "-", PingSent: 1426238316232, PongRecv: 1426238316232, LinkState: "disconnected", Epoch: 4,
+			},
+		},
+		{
+			name: "handshake",
+			line: testID3 + " 127.0.0.1:30007@31007 handshake,fail? - 0 0 0 connected",
+			want: &ClusterNode{
+				ID: testID3, Addr: "127.0.0.1:30007", Host: "127.0.0.1", Port: 30007, BusPort: 31007,
+				Flags: []string{"handshake", "fail?"}, State: StateHandshake | StatePFail,
+				MasterID: "-", LinkState: "connected", Connected: true,
+			},
+		},
+		{
+			name: "open slots",
+			line: testID1 + " 127.0.0.1:30001@31001 myself,master - 0 0 1 connected 0-10 [11->-" + testID2 + "] [12-<-" + testID3 + "]",
+			want: &ClusterNode{
+				ID: testID1, Addr: "127.0.0.1:30001", Host: "127.0.0.1", Port: 30001, BusPort: 31001,
+				Flags: []string{"myself", "master"}, Role: RoleMaster, Myself: true,
+				SlotsStr: "0-10", MasterID: "-", LinkState: "connected", Connected: true, Epoch: 1,
+				Migrating: map[int]string{11: testID2},
+				Importing: map[int]string{12: testID3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := parseClusterNode(tt.line)
+			if err != nil {
+				t.Fatalf("parseClusterNode error: %s", err)
+			}
+
+			want := *tt.want
+			want.Slots = NewSlots()
+			if want.SlotsStr != "" {
+				if err := want.Slots.SetSlotSlice(want.SlotsStr); err != nil {
+					t.Fatalf("SetSlotSlice error: %s", err)
+				}
+			}
+			if want.Migrating == nil {
+				want.Migrating = map[int]string{}
+			}
+			if want.Importing == nil {
+				want.Importing = map[int]string{}
+			}
+
+			if !reflect.DeepEqual(node, &want) {
+				t.Errorf("parseClusterNode =\n%+v\nwant\n%+v", node, &want)
+			}
+		})
+	}
+}
+
+func TestParseClusterNodeInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "too few fields", line: testID1 + " 127.0.0.1:30001@31001 master - 0 0 1"},
+		{name: "short id", line: "07c37dfe 127.0.0.1:30001@31001 master - 0 0 1 connected"},
+		{name: "upper case id", line: strings.ToUpper(testID1) + " 127.0.0.1:30001@31001 master - 0 0 1 connected"},
+		{name: "invalid master id", line: testID2 + " 127.0.0.1:30004@31004 slave nomaster 0 0 1 connected"},
+		{name: "no port", line: testID1 + " 127.0.0.1@31001 master - 0 0 1 connected"},
+		{name: "invalid bus port", line: testID1 + " 127.0.0.1:30001@bus master - 0 0 1 connected"},
+		{name: "invalid aux field", line: testID1 + " 127.0.0.1:30001@31001,host,shard-id master - 0 0 1 connected"},
+		{name: "empty flag", line: testID1 + " 127.0.0.1:30001@31001 master, - 0 0 1 connected"},
+		{name: "invalid ping-sent", line: testID1 + " 127.0.0.1:30001@31001 master - ping 0 1 connected"},
+		{name: "invalid pong-recv", line: testID1 + " 127.0.0.1:30001@31001 master - 0 pong 1 connected"},
+		{name: "invalid config-epoch", line: testID1 + " 127.0.0.1:30001@31001 master - 0 0 epoch connected"},
+		{name: "invalid link-state", line: testID1 + " 127.0.0.1:30001@31001 master - 0 0 1 linked"},
+		{name: "invalid slot", line: testID1 + " 127.0.0.1:30001@31001 master - 0 0 1 connected 16384"},
+		{name: "reversed slot range", line: testID1 + " 127.0.0.1:30001@31001 master - 0 0 1 connected 10-0"},
+		{name: "invalid open slot", line: testID1 + " 127.0.0.1:30001@31001 master - 0 0 1 connected [11-" + testID2 + "]"},
+		{name: "invalid open slot number", line: testID1 + " 127.0.0.1:30001@31001 master - 0 0 1 connected [x->-" + testID2 + "]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if node, err := parseClusterNode(tt.line); err == nil {
+				t.Errorf("parseClusterNode(%q) = %+v, want an error", tt.line, node)
+			}
+		})
+	}
+}
+
+func TestParseClusterNodes(t *testing.T) {
+	s := testID1 + " 127.0.0.1:30001@31001 myself,master - 0 0 1 connected 0-8191\r\n" +
+		testID2 + " 127.0.0.1:30002@31002 master - 0 0 2 connected 8192-16383\r\n" +
+		testID3 + " 127.0.0.1:30003@31003 slave " + testID1 + " 0 0 1 connected\r\n"
+
+	nodes, err := ParseClusterNodes(s)
+	if err != nil {
+		t.Fatalf("ParseClusterNodes error: %s", err)
+	}
+
+	var ids []string
+	for _, node := range nodes {
+		ids = append(ids, node.ID)
+	}
+	if want := []string{testID1, testID2, testID3}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ParseClusterNodes ids = %v, want %v", ids, want)
+	}
+
+	if _, err := ParseClusterNodes(s + "garbage\n"); err == nil {
+		t.Errorf("ParseClusterNodes with a malformed line, want an error")
+	}
+}
+
+func TestParseClusterInfo(t *testing.T) {
+	reply := strings.Join([]string{
+		"cluster_state:ok",
+		"cluster_slots_assigned:16384",
+		"cluster_slots_ok:16384",
+		"cluster_slots_pfail:0",
+		"cluster_slots_fail:0",
+		"cluster_known_nodes:6",
+		"cluster_size:3",
+		"cluster_current_epoch:6",
+		"cluster_my_epoch:2",
+		"cluster_stats_messages_ping_sent:1483972",
+		"cluster_stats_messages_pong_sent:1490391",
+		"cluster_stats_messages_meet_sent:2",
+		"cluster_stats_messages_sent:2974365",
+		"cluster_stats_messages_ping_received:1490386",
+		"cluster_stats_messages_pong_received:1483973",
+		"cluster_stats_messages_meet_received:5",
+		"cluster_stats_messages_received:2974364",
+		"total_cluster_links_buffer_limit_exceeded:0",
+		"",
+	}, "\r\n")
+
+	tests := []struct {
+		name  string
+		reply string
+		want  *ClusterInfo
+	}{
+		{
+			name:  "redis 7.2",
+			reply: reply,
+			want: &ClusterInfo{
+				State: "ok", SlotsAssigned: 16384, SlotsOK: 16384, KnownNodes: 6, Size: 3, CurrentEpoch: 6, MyEpoch: 2,
+				TotalMessagesSent: 2974365, TotalMessagesReceived: 2974364,
+				MessagesSent:     map[string]int64{"ping": 1483972, "pong": 1490391, "meet": 2},
+				MessagesReceived: map[string]int64{"ping": 1490386, "pong": 1483973, "meet": 5},
+			},
+		},
+		{
+			name:  "empty",
+			reply: "",
+			want:  &ClusterInfo{MessagesSent: map[string]int64{}, MessagesReceived: map[string]int64{}},
+		},
+		{
+			name: "unknown and invalid fields",
+			reply: "cluster_state:fail\r\ncluster_slots_assigned:16000\r\ncluster_slots_fail:n/a\r\ncluster_new_field:1\r\n" +
+				"cluster_stats_messages_fail_sent:x\r\ncluster_stats_messages_update_received:3\r\nno colon\r\n",
+			want: &ClusterInfo{
+				State: "fail", SlotsAssigned: 16000,
+				MessagesSent:     map[string]int64{},
+				MessagesReceived: map[string]int64{"update": 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseClusterInfo(tt.reply)
+			if err != nil {
+				t.Fatalf("ParseClusterInfo error: %s", err)
+			}
+			if !reflect.DeepEqual(info, tt.want) {
+				t.Errorf("ParseClusterInfo =\n%+v\nwant\n%+v", info, tt.want)
+			}
+			if ok := info.IsOK(); ok != (tt.want.State == "ok") {
+				t.Errorf("IsOK = %v", ok)
+			}
+		})
+	}
+}
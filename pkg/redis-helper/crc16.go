@@ -0,0 +1,45 @@
+package rh
+
+import "bytes"
+
+// crc16Table is the CRC16-CCITT (XMODEM) table used by redis cluster, polynomial 0x1021
+var crc16Table = func() [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^b]
+	}
+	return crc
+}
+
+// HashTag returns the part of key that is hashed: the content of the first non empty
+// {hashtag}, or the whole key, so keys sharing a hashtag land in the same slot.
+func HashTag(key []byte) []byte {
+	if start := bytes.IndexByte(key, '{'); start >= 0 {
+		if end := bytes.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+
+	return key
+}
+
+// KeySlot returns the hash slot of key, see HashTag.
+func KeySlot(key []byte) int {
+	return int(crc16(HashTag(key))) & (TotalSlots - 1)
+}
@@ -0,0 +1,53 @@
+package rh
+
+import "testing"
+
+func TestKeySlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		slot int
+	}{
+		{key: "123456789", slot: 12739},
+		{key: "foo", slot: 12182},
+		{key: "", slot: 0},
+		{key: "{foo}bar", slot: 12182},
+		{key: "bar{foo}", slot: 12182},
+	}
+
+	for _, tt := range tests {
+		if slot := KeySlot([]byte(tt.key)); slot != tt.slot {
+			t.Errorf("KeySlot(%q) = %d, want %d", tt.key, slot, tt.slot)
+		}
+	}
+}
+
+func TestHashTag(t *testing.T) {
+	tests := []struct {
+		key string
+		tag string
+	}{
+		{key: "foo", tag: "foo"},
+		{key: "{foo}", tag: "foo"},
+		{key: "user:{1000}:name", tag: "1000"},
+		// an empty hashtag hashes the whole key
+		{key: "{}", tag: "{}"},
+		{key: "foo{}{bar}", tag: "foo{}{bar}"},
+		// an unclosed or reversed brace hashes the whole key
+		{key: "{", tag: "{"},
+		{key: "}{", tag: "}{"},
+		{key: "foo{bar", tag: "foo{bar"},
+		// only the first hashtag counts
+		{key: "{a}{b}", tag: "a"},
+		{key: "foo{{bar}}", tag: "{bar"},
+	}
+
+	for _, tt := range tests {
+		if tag := string(HashTag([]byte(tt.key))); tag != tt.tag {
+			t.Errorf("HashTag(%q) = %q, want %q", tt.key, tag, tt.tag)
+		}
+
+		if slot, want := KeySlot([]byte(tt.key)), KeySlot([]byte(tt.tag)); slot != want {
+			t.Errorf("KeySlot(%q) = %d, want %d", tt.key, slot, want)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package rh
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Info holds the main sections of INFO, the fields are set from the keys of their info tag.
+// Sections not requested are left zero.
+type Info struct {
+	Server      InfoServer
+	Clients     InfoClients
+	Memory      InfoMemory
+	Persistence InfoPersistence
+	Stats       InfoStats
+	Replication InfoReplication
+	// Keyspace maps the db index to its keys
+	Keyspace map[int]KeyspaceDB
+}
+
+type InfoServer struct {
+	RedisVersion    string `info:"redis_version"`
+	RedisMode       string `info:"redis_mode"`
+	OS              string `info:"os"`
+	ArchBits        int64  `info:"arch_bits"`
+	ProcessID       int64  `info:"process_id"`
+	RunID           string `info:"run_id"`
+	TCPPort         int64  `info:"tcp_port"`
+	UptimeInSeconds int64  `info:"uptime_in_seconds"`
+	Hz              int64  `info:"hz"`
+	Executable      string `info:"executable"`
+	ConfigFile      string `info:"config_file"`
+}
+
+type InfoClients struct {
+	ConnectedClients   int64 `info:"connected_clients"`
+	ClusterConnections int64 `info:"cluster_connections"`
+	MaxClients         int64 `info:"maxclients"`
+	BlockedClients     int64 `info:"blocked_clients"`
+	TrackingClients    int64 `info:"tracking_clients"`
+}
+
+type InfoMemory struct {
+	UsedMemory            int64   `info:"used_memory"`
+	UsedMemoryRSS         int64   `info:"used_memory_rss"`
+	UsedMemoryPeak        int64   `info:"used_memory_peak"`
+	UsedMemoryOverhead    int64   `info:"used_memory_overhead"`
+	UsedMemoryDataset     int64   `info:"used_memory_dataset"`
+	UsedMemoryLua         int64   `info:"used_memory_lua"`
+	TotalSystemMemory     int64   `info:"total_system_memory"`
+	MaxMemory             int64   `info:"maxmemory"`
+	MaxMemoryPolicy       string  `info:"maxmemory_policy"`
+	MemFragmentationRatio float64 `info:"mem_fragmentation_ratio"`
+	MemAllocator          string  `info:"mem_allocator"`
+}
+
+type InfoPersistence struct {
+	Loading                  int64  `info:"loading"`
+	RDBChangesSinceLastSave  int64  `info:"rdb_changes_since_last_save"`
+	RDBBgsaveInProgress      int64  `info:"rdb_bgsave_in_progress"`
+	RDBLastSaveTime          int64  `info:"rdb_last_save_time"`
+	RDBLastBgsaveStatus      string `info:"rdb_last_bgsave_status"`
+	AOFEnabled               int64  `info:"aof_enabled"`
+	AOFRewriteInProgress     int64  `info:"aof_rewrite_in_progress"`
+	AOFLastBgrewriteStatus   string `info:"aof_last_bgrewrite_status"`
+	AOFLastWriteStatus       string `info:"aof_last_write_status"`
+	AOFRewriteScheduled      int64  `info:"aof_rewrite_scheduled"`
+	RDBLastBgsaveTimeSeconds int64  `info:"rdb_last_bgsave_time_sec"`
+}
+
+type InfoStats struct {
+	TotalConnectionsReceived int64   `info:"total_connections_received"`
+	TotalCommandsProcessed   int64   `info:"total_commands_processed"`
+	InstantaneousOpsPerSec   int64   `info:"instantaneous_ops_per_sec"`
+	TotalNetInputBytes       int64   `info:"total_net_input_bytes"`
+	TotalNetOutputBytes      int64   `info:"total_net_output_bytes"`
+	InstantaneousInputKbps   float64 `info:"instantaneous_input_kbps"`
+	InstantaneousOutputKbps  float64 `info:"instantaneous_output_kbps"`
+	RejectedConnections      int64   `info:"rejected_connections"`
+	ExpiredKeys              int64   `info:"expired_keys"`
+	EvictedKeys              int64   `info:"evicted_keys"`
+	KeyspaceHits             int64   `info:"keyspace_hits"`
+	KeyspaceMisses           int64   `info:"keyspace_misses"`
+	LatestForkUsec           int64   `info:"latest_fork_usec"`
+	MigrateCachedSockets     int64   `info:"migrate_cached_sockets"`
+}
+
+type InfoReplication struct {
+	Role                 string `info:"role"`
+	ConnectedSlaves      int64  `info:"connected_slaves"`
+	MasterReplID         string `info:"master_replid"`
+	MasterReplOffset     int64  `info:"master_repl_offset"`
+	MasterHost           string `info:"master_host"`
+	MasterPort           int64  `info:"master_port"`
+	MasterLinkStatus     string `info:"master_link_status"`
+	MasterLastIOSecsAgo  int64  `info:"master_last_io_seconds_ago"`
+	MasterSyncInProgress int64  `info:"master_sync_in_progress"`
+	SlaveReplOffset      int64  `info:"slave_repl_offset"`
+	ReplBacklogActive    int64  `info:"repl_backlog_active"`
+	ReplBacklogSize      int64  `info:"repl_backlog_size"`
+	// Slaves are the slaveN lines of a master
+	Slaves []InfoSlave
+}
+
+// InfoSlave is a slaveN line: ip=...,port=...,state=...,offset=...,lag=...
+type InfoSlave struct {
+	IP     string `info:"ip"`
+	Port   int64  `info:"port"`
+	State  string `info:"state"`
+	Offset int64  `info:"offset"`
+	Lag    int64  `info:"lag"`
+}
+
+// KeyspaceDB is a dbN line: keys=...,expires=...,avg_ttl=...
+type KeyspaceDB struct {
+	Keys    int64 `info:"keys"`
+	Expires int64 `info:"expires"`
+	AvgTTL  int64 `info:"avg_ttl"`
+}
+
+// GetInfo runs INFO for every section, the default sections if none, and parses the reply
+func (c *Client) GetInfo(ctx context.Context, sections ...string) (*Info, error) {
+	if len(sections) == 0 {
+		sections = []string{""}
+	}
+
+	var reply strings.Builder
+	for _, section := range sections {
+		args := []string{}
+		if section != "" {
+			args = append(args, section)
+		}
+
+		s, err := c.Info(ctx, args...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("info %s. addr:%s, err:%s", section, c.Addr, err)
+		}
+		reply.WriteString(s)
+		reply.WriteString("\n")
+	}
+
+	return ParseInfo(reply.String())
+}
+
+// ParseInfo parses the reply of INFO, unknown sections and fields are ignored.
+// A field which does not parse, like one whose format changed in another redis version, is left zero.
+func ParseInfo(s string) (*Info, error) {
+	info := &Info{Keyspace: map[int]KeyspaceDB{}}
+
+	for section, fields := range parseInfoSections(s) {
+		switch section {
+		case "server":
+			setInfoFields(&info.Server, fields)
+		case "clients":
+			setInfoFields(&info.Clients, fields)
+		case "memory":
+			setInfoFields(&info.Memory, fields)
+		case "persistence":
+			setInfoFields(&info.Persistence, fields)
+		case "stats":
+			setInfoFields(&info.Stats, fields)
+		case "replication":
+			setInfoFields(&info.Replication, fields)
+			for i := 0; ; i++ {
+				line, ok := fields[fmt.Sprintf("slave%d", i)]
+				if !ok {
+					break
+				}
+				var slave InfoSlave
+				setInfoFields(&slave, parseInfoValues(line))
+				info.Replication.Slaves = append(info.Replication.Slaves, slave)
+			}
+		case "keyspace":
+			for key, line := range fields {
+				db, err := strconv.Atoi(strings.TrimPrefix(key, "db"))
+				if err != nil {
+					logInvalidInfoField(key, line)
+					continue
+				}
+				var keyspace KeyspaceDB
+				setInfoFields(&keyspace, parseInfoValues(line))
+				info.Keyspace[db] = keyspace
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// parseInfoSections splits the reply of INFO into its "# Section" blocks of key:value lines
+func parseInfoSections(s string) map[string]map[string]string {
+	sections := make(map[string]map[string]string)
+
+	var fields map[string]string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(line, "#")))
+			if sections[name] == nil {
+				sections[name] = make(map[string]string)
+			}
+			fields = sections[name]
+			continue
+		}
+
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 || fields == nil {
+			continue
+		}
+		fields[kv[0]] = kv[1]
+	}
+
+	return sections
+}
+
+// parseInfoValues splits the k1=v1,k2=v2 values of the slaveN and dbN fields
+func parseInfoValues(s string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 2 {
+			values[kv[0]] = kv[1]
+		}
+	}
+	return values
+}
+
+// setInfoFields sets the string, int64 and float64 fields of the struct v points to from the fields
+// named by their info tag, the fields which do not parse are left unchanged
+func setInfoFields(v interface{}, fields map[string]string) {
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		key := rt.Field(i).Tag.Get("info")
+		value, ok := fields[key]
+		if key == "" || !ok {
+			continue
+		}
+
+		field := rv.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int64:
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				logInvalidInfoField(key, value)
+				continue
+			}
+			field.SetInt(n)
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				logInvalidInfoField(key, value)
+				continue
+			}
+			field.SetFloat(f)
+		}
+	}
+}
+
+// invalidInfoFields are the fields already logged, INFO is polled so each one is logged once
+var invalidInfoFields sync.Map
+
+func logInvalidInfoField(key, value string) {
+	if _, logged := invalidInfoFields.LoadOrStore(key, true); !logged {
+		log.Printf("info field %s ignored, invalid value %q", key, value)
+	}
+}
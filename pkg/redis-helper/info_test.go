@@ -0,0 +1,125 @@
+package rh
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseInfoReply(t *testing.T) {
+	data, err := os.ReadFile("testdata/info-7.2.txt")
+	if err != nil {
+		t.Fatalf("read info error: %s", err)
+	}
+
+	info, err := ParseInfo(string(data))
+	if err != nil {
+		t.Fatalf("ParseInfo error: %s", err)
+	}
+
+	want := &Info{
+		Server: InfoServer{
+			RedisVersion: "7.2.4", RedisMode: "cluster", OS: "Linux 5.15.0-91-generic x86_64", ArchBits: 64, ProcessID: 1,
+			RunID: "5c1e3f0c2d2b8f2b5a3c1f9a8b7e6d5c4b3a2910", TCPPort: 6379, UptimeInSeconds: 864000, Hz: 10,
+			Executable: "/data/redis-server", ConfigFile: "/etc/redis/redis.conf",
+		},
+		Clients: InfoClients{ConnectedClients: 12, ClusterConnections: 10, MaxClients: 10000},
+		Memory: InfoMemory{
+			UsedMemory: 1073741824, UsedMemoryRSS: 1288490188, UsedMemoryPeak: 1181116006, UsedMemoryOverhead: 52428800,
+			UsedMemoryDataset: 1021313024, UsedMemoryLua: 31744, TotalSystemMemory: 16777216000, MaxMemory: 4294967296,
+			MaxMemoryPolicy: "noeviction", MemFragmentationRatio: 1.2, MemAllocator: "jemalloc-5.3.0",
+		},
+		Persistence: InfoPersistence{
+			RDBChangesSinceLastSave: 1523, RDBLastSaveTime: 1729230000, RDBLastBgsaveStatus: "ok", AOFEnabled: 1,
+			AOFLastBgrewriteStatus: "ok", AOFLastWriteStatus: "ok", RDBLastBgsaveTimeSeconds: 3,
+		},
+		Stats: InfoStats{
+			TotalConnectionsReceived: 5021, TotalCommandsProcessed: 98765432, InstantaneousOpsPerSec: 1520,
+			TotalNetInputBytes: 12345678901, TotalNetOutputBytes: 23456789012, InstantaneousInputKbps: 120.55,
+			InstantaneousOutputKbps: 340.10, ExpiredKeys: 1234, KeyspaceHits: 5000000, KeyspaceMisses: 250000,
+			LatestForkUsec: 12345, MigrateCachedSockets: 1,
+		},
+		Replication: InfoReplication{
+			Role: "master", ConnectedSlaves: 2, MasterReplID: "3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a",
+			MasterReplOffset: 3456789012, ReplBacklogActive: 1, ReplBacklogSize: 1048576,
+			Slaves: []InfoSlave{
+				{IP: "10.0.0.2", Port: 6379, State: "online", Offset: 3456789012, Lag: 0},
+				{IP: "10.0.0.3", Port: 6379, State: "wait_bgsave", Offset: 0, Lag: 1},
+			},
+		},
+		Keyspace: map[int]KeyspaceDB{0: {Keys: 1500000, Expires: 12000, AvgTTL: 3600000}},
+	}
+
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("ParseInfo =\n%+v\nwant\n%+v", info, want)
+	}
+}
+
+func TestParseInfo(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  *Info
+	}{
+		{
+			name:  "empty",
+			reply: "",
+			want:  &Info{Keyspace: map[int]KeyspaceDB{}},
+		},
+		{
+			name:  "unknown sections and fields",
+			reply: "# Memory\r\nused_memory:100\r\nused_memory_new_field:7\r\n# NewSection\r\nmaxmemory:1\r\n",
+			want:  &Info{Memory: InfoMemory{UsedMemory: 100}, Keyspace: map[int]KeyspaceDB{}},
+		},
+		{
+			name:  "fields not parsing are left zero",
+			reply: "# Memory\r\nused_memory:100\r\nmaxmemory:4gb\r\nmem_fragmentation_ratio:n/a\r\nmaxmemory_policy:allkeys-lru\r\n",
+			want:  &Info{Memory: InfoMemory{UsedMemory: 100, MaxMemoryPolicy: "allkeys-lru"}, Keyspace: map[int]KeyspaceDB{}},
+		},
+		{
+			name:  "fields before any section and lines without colon",
+			reply: "used_memory:100\r\n# Memory\r\ngarbage\r\nmaxmemory:200\r\n",
+			want:  &Info{Memory: InfoMemory{MaxMemory: 200}, Keyspace: map[int]KeyspaceDB{}},
+		},
+		{
+			name:  "values with colons",
+			reply: "# Server\r\nexecutable:C:\\redis\\redis-server.exe\r\n",
+			want:  &Info{Server: InfoServer{Executable: "C:\\redis\\redis-server.exe"}, Keyspace: map[int]KeyspaceDB{}},
+		},
+		{
+			name: "replica",
+			reply: "# Replication\r\nrole:slave\r\nmaster_host:10.0.0.1\r\nmaster_port:6379\r\nmaster_link_status:up\r\n" +
+				"master_last_io_seconds_ago:1\r\nmaster_sync_in_progress:0\r\nslave_repl_offset:42\r\nconnected_slaves:0\r\n",
+			want: &Info{
+				Replication: InfoReplication{Role: "slave", MasterHost: "10.0.0.1", MasterPort: 6379, MasterLinkStatus: "up",
+					MasterLastIOSecsAgo: 1, SlaveReplOffset: 42},
+				Keyspace: map[int]KeyspaceDB{},
+			},
+		},
+		{
+			name:  "slave lines with extra and invalid values",
+			reply: "# Replication\r\nrole:master\r\nslave0:ip=10.0.0.2,port=6379,state=online,offset=x,lag=0,extra=1\r\n",
+			want: &Info{
+				Replication: InfoReplication{Role: "master", Slaves: []InfoSlave{{IP: "10.0.0.2", Port: 6379, State: "online"}}},
+				Keyspace:    map[int]KeyspaceDB{},
+			},
+		},
+		{
+			name:  "keyspace",
+			reply: "# Keyspace\r\ndb0:keys=10,expires=1,avg_ttl=0,subexpiry=0\r\ndb3:keys=5,expires=0,avg_ttl=0\r\ndbx:keys=1\r\n",
+			want:  &Info{Keyspace: map[int]KeyspaceDB{0: {Keys: 10, Expires: 1}, 3: {Keys: 5}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseInfo(tt.reply)
+			if err != nil {
+				t.Fatalf("ParseInfo error: %s", err)
+			}
+			if !reflect.DeepEqual(info, tt.want) {
+				t.Errorf("ParseInfo =\n%+v\nwant\n%+v", info, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package rh
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// countKeysBatch is the number of commands sent in one pipeline
+const countKeysBatch = 1000
+
+// CountKeysInSlots returns the key count of every slot of slots, pipelining CLUSTER COUNTKEYSINSLOT
+func (c *Client) CountKeysInSlots(ctx context.Context, slots Slots) (map[int]int64, error) {
+	counts := make(map[int]int64, slots.SlotsCount())
+
+	var batch []int
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		pip := c.Pipeline()
+		cmds := make([]*redis.IntCmd, len(batch))
+		for i, slot := range batch {
+			cmds[i] = pip.ClusterCountKeysInSlot(ctx, slot)
+		}
+
+		if _, err := pip.Exec(ctx); err != nil {
+			return fmt.Errorf("cluster countkeysinslot. addr:%s, err:%s", c.Addr, err)
+		}
+
+		for i, cmd := range cmds {
+			counts[batch[i]] = cmd.Val()
+		}
+
+		batch = batch[:0]
+		return nil
+	}
+
+	for slot := 0; slot < TotalSlots; slot++ {
+		if !slots.IsSet(slot) {
+			continue
+		}
+
+		batch = append(batch, slot)
+		if len(batch) == countKeysBatch {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// ScanKeys calls fn for the keys of the node, stopping after limit keys, a limit <= 0 scans them all.
+// An error of fn stops the scan and is returned.
+func (c *Client) ScanKeys(ctx context.Context, limit int64, fn func(key string) error) error {
+	var (
+		cursor  uint64
+		scanned int64
+	)
+
+	for {
+		keys, next, err := c.Scan(ctx, cursor, "", countKeysBatch).Result()
+		if err != nil {
+			return fmt.Errorf("scan. addr:%s, err:%s", c.Addr, err)
+		}
+
+		for _, key := range keys {
+			if limit > 0 && scanned >= limit {
+				return nil
+			}
+
+			if err := fn(key); err != nil {
+				return err
+			}
+			scanned++
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,115 @@
+package rh
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// EstimateSlotsMemory estimates the bytes held by every slot of slots: the MEMORY USAGE of up to
+// sample keys from CLUSTER GETKEYSINSLOT, averaged and scaled by the key count of the slot.
+func (c *Client) EstimateSlotsMemory(ctx context.Context, slots Slots, sample int) (map[int]int64, error) {
+	if sample <= 0 {
+		return nil, fmt.Errorf("invalid sample %d", sample)
+	}
+
+	counts, err := c.CountKeysInSlots(ctx, slots)
+	if err != nil {
+		return nil, err
+	}
+
+	// a batch pipelines about countKeysBatch MEMORY USAGE
+	batchSlots := countKeysBatch/sample + 1
+
+	estimates := make(map[int]int64, len(counts))
+	var batch []int
+	for slot := 0; slot < TotalSlots; slot++ {
+		count, ok := counts[slot]
+		if !ok {
+			continue
+		}
+
+		estimates[slot] = 0
+		if count == 0 {
+			continue
+		}
+
+		batch = append(batch, slot)
+		if len(batch) == batchSlots {
+			if err := c.estimateBatch(ctx, batch, counts, sample, estimates); err != nil {
+				return nil, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err := c.estimateBatch(ctx, batch, counts, sample, estimates); err != nil {
+		return nil, err
+	}
+
+	return estimates, nil
+}
+
+func (c *Client) estimateBatch(ctx context.Context, slots []int, counts map[int]int64, sample int, estimates map[int]int64) error {
+	if len(slots) == 0 {
+		return nil
+	}
+
+	pip := c.Pipeline()
+	keysCmds := make([]*redis.StringSliceCmd, len(slots))
+	for i, slot := range slots {
+		keysCmds[i] = pip.ClusterGetKeysInSlot(ctx, slot, sample)
+	}
+	if _, err := pip.Exec(ctx); err != nil {
+		return fmt.Errorf("cluster getkeysinslot. addr:%s, err:%s", c.Addr, err)
+	}
+
+	pip = c.Pipeline()
+	usageCmds := make([][]*redis.IntCmd, len(slots))
+	for i, cmd := range keysCmds {
+		for _, key := range cmd.Val() {
+			usageCmds[i] = append(usageCmds[i], pip.MemoryUsage(ctx, key))
+		}
+	}
+	// keys expiring between the two pipelines answer nil
+	if _, err := pip.Exec(ctx); err != nil && err != redis.Nil {
+		return fmt.Errorf("memory usage. addr:%s, err:%s", c.Addr, err)
+	}
+
+	for i, slot := range slots {
+		var bytes, sampled int64
+		for _, cmd := range usageCmds[i] {
+			if cmd.Err() != nil {
+				continue
+			}
+			bytes += cmd.Val()
+			sampled++
+		}
+
+		if sampled > 0 {
+			estimates[slot] = bytes * counts[slot] / sampled
+		}
+	}
+
+	return nil
+}
+
+// MaxMemory returns the maxmemory of the node, 0 when unlimited.
+// INFO memory is the fallback when CONFIG is renamed or disabled.
+func (c *Client) MaxMemory(ctx context.Context) (int64, error) {
+	config, err := c.ConfigGet(ctx, "maxmemory").Result()
+	if err == nil && len(config) == 2 {
+		if value, ok := config[1].(string); ok {
+			return strconv.ParseInt(value, 10, 64)
+		}
+	}
+
+	info, err := c.GetInfo(ctx, "memory")
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Memory.MaxMemory, nil
+}
@@ -0,0 +1,230 @@
+package rh
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type memoryNode struct {
+	node      *ClusterNode
+	weight    float64
+	target    int64
+	bytes     int64
+	maxMemory int64
+	// used is the used_memory of the node, following the bytes of the slots moved
+	used int64
+	// slots owned by the node and not moved yet, largest first
+	slots []int
+}
+
+func (mn *memoryNode) excess() int64 {
+	return mn.bytes - mn.target
+}
+
+// room is the bytes the node can receive before its used memory reaches its maxmemory
+func (mn *memoryNode) room() int64 {
+	if mn.maxMemory <= 0 {
+		return math.MaxInt64
+	}
+	return mn.maxMemory - mn.used
+}
+
+// PlanMemoryRebalance computes the moves spreading the estimated bytes of the slots across the
+// masters in proportion to their weight, as PlanRebalance does for the slots count.
+// slotBytes maps slot to its estimated bytes, see EstimateSlotsMemory, maxMemory maps node ID
+// to its maxmemory, 0 or missing is unlimited, and usedMemory maps node ID to its used_memory,
+// the estimated bytes of its slots if missing. A master never receives a slot taking its used
+// memory, keys plus overhead, above its maxmemory. Nothing moves when every master is within threshold percent of its expected bytes,
+// and every slot moves at most once.
+func PlanMemoryRebalance(nodes []*ClusterNode, slotBytes map[int]int64, maxMemory, usedMemory map[string]int64,
+	weights map[string]float64, threshold float64) ([]SlotMove, error) {
+	if err := checkWeights(nodes, weights); err != nil {
+		return nil, err
+	}
+
+	var (
+		memoryNodes []*memoryNode
+		totalWeight float64
+		totalBytes  int64
+	)
+
+	for _, node := range nodes {
+		if !node.IsMaster() {
+			continue
+		}
+
+		if !node.IsHealthy() {
+			return nil, fmt.Errorf("master %s is not healthy, state:%s", node.ID, node.State)
+		}
+
+		weight, ok := weights[node.ID]
+		if !ok {
+			weight = 1
+		}
+
+		mn := &memoryNode{node: node, weight: weight, maxMemory: maxMemory[node.ID]}
+		for slot := 0; slot < TotalSlots; slot++ {
+			if node.Slots.IsSet(slot) {
+				mn.slots = append(mn.slots, slot)
+				mn.bytes += slotBytes[slot]
+			}
+		}
+		sort.SliceStable(mn.slots, func(i, j int) bool { return slotBytes[mn.slots[i]] > slotBytes[mn.slots[j]] })
+
+		mn.used = mn.bytes
+		if used, ok := usedMemory[node.ID]; ok {
+			mn.used = used
+		}
+
+		memoryNodes = append(memoryNodes, mn)
+		totalWeight += weight
+		totalBytes += mn.bytes
+	}
+
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("total weight of masters is 0")
+	}
+
+	sort.Slice(memoryNodes, func(i, j int) bool { return memoryNodes[i].node.ID < memoryNodes[j].node.ID })
+
+	needRebalance := false
+	for _, mn := range memoryNodes {
+		mn.target = int64(float64(totalBytes) * mn.weight / totalWeight)
+
+		if mn.weight == 0 {
+			needRebalance = needRebalance || len(mn.slots) > 0
+			continue
+		}
+
+		if mn.target > 0 && math.Abs(float64(mn.excess()))/float64(mn.target)*100 > threshold {
+			needRebalance = true
+		}
+	}
+
+	if !needRebalance {
+		return nil, nil
+	}
+
+	moves, err := planEmptyMoves(memoryNodes, slotBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(moves, planMemoryMoves(memoryNodes, slotBytes)...), nil
+}
+
+// planEmptyMoves moves every slot of the nodes weighing 0, largest first, to the node lacking the most bytes
+func planEmptyMoves(memoryNodes []*memoryNode, slotBytes map[int]int64) ([]SlotMove, error) {
+	var moves []SlotMove
+	for _, donor := range memoryNodes {
+		if donor.weight != 0 {
+			continue
+		}
+
+		for _, slot := range donor.slots {
+			var receiver *memoryNode
+			for _, mn := range memoryNodes {
+				if mn.weight == 0 || mn.room() < slotBytes[slot] {
+					continue
+				}
+				if receiver == nil || mn.excess() < receiver.excess() {
+					receiver = mn
+				}
+			}
+
+			if receiver == nil {
+				return nil, fmt.Errorf("no master has room for slot %d of %s, %d bytes", slot, donor.node.ID, slotBytes[slot])
+			}
+
+			moves = append(moves, newMemoryMove(donor, receiver, slot, slotBytes))
+		}
+		donor.slots = nil
+	}
+
+	return moves, nil
+}
+
+// planMemoryMoves repeatedly moves a slot from the node holding the most bytes above its target
+// to a node lacking bytes, as long as the move lowers the deviation from the targets
+func planMemoryMoves(memoryNodes []*memoryNode, slotBytes map[int]int64) []SlotMove {
+	var moves []SlotMove
+	for {
+		sort.SliceStable(memoryNodes, func(i, j int) bool { return memoryNodes[i].excess() > memoryNodes[j].excess() })
+
+		moved := false
+		for _, donor := range memoryNodes {
+			if donor.excess() <= 0 {
+				break
+			}
+
+			for i := len(memoryNodes) - 1; i >= 0 && memoryNodes[i].excess() < 0; i-- {
+				receiver := memoryNodes[i]
+
+				index := pickSlot(donor, receiver, slotBytes)
+				if index < 0 {
+					continue
+				}
+
+				slot := donor.slots[index]
+				donor.slots = append(donor.slots[:index], donor.slots[index+1:]...)
+				moves = append(moves, newMemoryMove(donor, receiver, slot, slotBytes))
+				moved = true
+				break
+			}
+
+			if moved {
+				break
+			}
+		}
+
+		if !moved {
+			return moves
+		}
+	}
+}
+
+// pickSlot returns the index in donor.slots of the largest slot not exceeding the excess of donor
+// nor the lack of receiver, or else of the smallest slot still lowering the deviation, -1 if none
+func pickSlot(donor, receiver *memoryNode, slotBytes map[int]int64) int {
+	excess, lack, room := donor.excess(), -receiver.excess(), receiver.room()
+
+	limit := excess
+	if lack < limit {
+		limit = lack
+	}
+	if room < limit {
+		limit = room
+	}
+
+	// slots are sorted largest first
+	index := sort.Search(len(donor.slots), func(i int) bool { return slotBytes[donor.slots[i]] <= limit })
+	if index < len(donor.slots) && slotBytes[donor.slots[index]] > 0 {
+		return index
+	}
+
+	// moving bytes lowers the sum of the squared deviations while bytes < excess + lack
+	if index > 0 {
+		bytes := slotBytes[donor.slots[index-1]]
+		if bytes < excess+lack && bytes <= room {
+			return index - 1
+		}
+	}
+
+	return -1
+}
+
+func newMemoryMove(donor, receiver *memoryNode, slot int, slotBytes map[int]int64) SlotMove {
+	donor.bytes -= slotBytes[slot]
+	receiver.bytes += slotBytes[slot]
+	donor.used -= slotBytes[slot]
+	receiver.used += slotBytes[slot]
+
+	return SlotMove{
+		Slot:      slot,
+		SrcNodeID: donor.node.ID,
+		SrcAddr:   donor.node.Addr,
+		DstNodeID: receiver.node.ID,
+		DstAddr:   receiver.node.Addr,
+	}
+}
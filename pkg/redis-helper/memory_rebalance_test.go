@@ -0,0 +1,174 @@
+package rh
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testSlotBytes sets bytes for every slot of slots
+func testSlotBytes(t *testing.T, slotBytes map[int]int64, slots string, bytes int64) {
+	t.Helper()
+
+	for _, r := range mustParseSlots(t, slots).Ranges() {
+		for slot := r.Begin; slot <= r.End; slot++ {
+			slotBytes[slot] = bytes
+		}
+	}
+}
+
+func TestPlanMemoryRebalance(t *testing.T) {
+	tests := []struct {
+		name       string
+		slots      map[string]string
+		slotBytes  map[string]int64
+		maxMemory  map[string]int64
+		usedMemory map[string]int64
+		weights    map[string]float64
+		threshold  float64
+		moves      int
+		bytes      map[string]int64
+	}{
+		{
+			name:      "spread evenly",
+			slots:     map[string]string{"a": "0-9", "b": "10-19"},
+			slotBytes: map[string]int64{"0-9": 100},
+			moves:     5,
+			bytes:     map[string]int64{"a": 500, "b": 500},
+		},
+		{
+			name:      "largest slots first",
+			slots:     map[string]string{"a": "0-3", "b": "4"},
+			slotBytes: map[string]int64{"0": 400, "1": 300, "2": 200, "3": 100},
+			moves:     2,
+			bytes:     map[string]int64{"a": 500, "b": 500},
+		},
+		{
+			name:      "weights",
+			slots:     map[string]string{"a": "0-9", "b": "10-19"},
+			slotBytes: map[string]int64{"0-19": 100},
+			weights:   map[string]float64{"a": 3},
+			moves:     5,
+			bytes:     map[string]int64{"a": 1500, "b": 500},
+		},
+		{
+			name:      "maxmemory caps the receiver",
+			slots:     map[string]string{"a": "0-9", "b": "10-19"},
+			slotBytes: map[string]int64{"0-9": 100},
+			maxMemory: map[string]int64{"b": 300},
+			moves:     3,
+			bytes:     map[string]int64{"a": 700, "b": 300},
+		},
+		{
+			name:       "used memory caps the receiver",
+			slots:      map[string]string{"a": "0-9", "b": "10-19"},
+			slotBytes:  map[string]int64{"0-9": 100},
+			maxMemory:  map[string]int64{"b": 500},
+			usedMemory: map[string]int64{"a": 1100, "b": 250},
+			moves:      2,
+			bytes:      map[string]int64{"a": 800, "b": 200},
+		},
+		{
+			name:      "weight 0 empties the master",
+			slots:     map[string]string{"a": "0-4", "b": "5-9", "c": "10-11"},
+			slotBytes: map[string]int64{"0-11": 100},
+			weights:   map[string]float64{"c": 0},
+			moves:     2,
+			bytes:     map[string]int64{"a": 600, "b": 600, "c": 0},
+		},
+		{
+			name:      "within threshold",
+			slots:     map[string]string{"a": "0-9", "b": "10-19"},
+			slotBytes: map[string]int64{"0-9": 100, "10-19": 90},
+			threshold: 10,
+			moves:     0,
+			bytes:     map[string]int64{"a": 1000, "b": 900},
+		},
+		{
+			name:      "no slot lowers the deviation",
+			slots:     map[string]string{"a": "0", "b": "1"},
+			slotBytes: map[string]int64{"0": 1000, "1": 10},
+			moves:     0,
+			bytes:     map[string]int64{"a": 1000, "b": 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nodes []*ClusterNode
+			for _, id := range []string{"a", "b", "c"} {
+				if s, ok := tt.slots[id]; ok {
+					nodes = append(nodes, newTestMaster(t, id, s))
+				}
+			}
+
+			slotBytes := make(map[int]int64)
+			for slots, bytes := range tt.slotBytes {
+				testSlotBytes(t, slotBytes, slots, bytes)
+			}
+
+			moves, err := PlanMemoryRebalance(nodes, slotBytes, tt.maxMemory, tt.usedMemory, tt.weights, tt.threshold)
+			if err != nil {
+				t.Fatalf("PlanMemoryRebalance error: %s", err)
+			}
+			if len(moves) != tt.moves {
+				t.Errorf("PlanMemoryRebalance moves = %d, want %d", len(moves), tt.moves)
+			}
+
+			bytes := make(map[string]int64)
+			for id, slots := range applyMoves(t, nodes, moves) {
+				bytes[id] = 0
+				for _, r := range slots.Ranges() {
+					for slot := r.Begin; slot <= r.End; slot++ {
+						bytes[id] += slotBytes[slot]
+					}
+				}
+			}
+			if !reflect.DeepEqual(bytes, tt.bytes) {
+				t.Errorf("PlanMemoryRebalance bytes = %v, want %v", bytes, tt.bytes)
+			}
+		})
+	}
+}
+
+func TestPlanMemoryRebalanceInvalid(t *testing.T) {
+	unhealthy := newTestMaster(t, "b", "")
+	unhealthy.State = StateFail
+
+	slotBytes := map[int]int64{0: 1000}
+
+	tests := []struct {
+		name      string
+		nodes     []*ClusterNode
+		maxMemory map[string]int64
+		weights   map[string]float64
+	}{
+		{
+			name:  "unhealthy master",
+			nodes: []*ClusterNode{newTestMaster(t, "a", "0-16383"), unhealthy},
+		},
+		{
+			name:    "weighted node unknown",
+			nodes:   []*ClusterNode{newTestMaster(t, "a", "0-16383")},
+			weights: map[string]float64{"x": 1},
+		},
+		{
+			name:    "total weight 0",
+			nodes:   []*ClusterNode{newTestMaster(t, "a", "0-8191"), newTestMaster(t, "b", "8192-16383")},
+			weights: map[string]float64{"a": 0, "b": 0},
+		},
+		{
+			name:      "no room for the slots of a master weighing 0",
+			nodes:     []*ClusterNode{newTestMaster(t, "a", "0"), newTestMaster(t, "b", "1")},
+			maxMemory: map[string]int64{"b": 500},
+			weights:   map[string]float64{"a": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if moves, err := PlanMemoryRebalance(tt.nodes, slotBytes, tt.maxMemory, nil, tt.weights, 0); err == nil {
+				t.Errorf("PlanMemoryRebalance = %d moves, want an error", len(moves))
+			}
+		})
+	}
+}
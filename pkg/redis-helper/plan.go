@@ -0,0 +1,121 @@
+package rh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// SlotMove describes the migration of one slot from a source master to a destination master.
+type SlotMove struct {
+	Slot      int    `json:"slot"`
+	SrcNodeID string `json:"src_node_id"`
+	SrcAddr   string `json:"src_addr"`
+	DstNodeID string `json:"dst_node_id"`
+	DstAddr   string `json:"dst_addr"`
+	// KeyCount is the estimated key count from CLUSTER COUNTKEYSINSLOT when the plan was built
+	KeyCount int64 `json:"key_count"`
+}
+
+// MigrationPlan is a reviewable list of slot moves, bound to the topology it was computed from.
+type MigrationPlan struct {
+	CreatedAt time.Time `json:"created_at"`
+	Addr      string    `json:"addr"`
+	// Topology is the fingerprint of the masters and their slots, see TopologyFingerprint
+	Topology string     `json:"topology"`
+	Moves    []SlotMove `json:"moves"`
+}
+
+func NewMigrationPlan(addr string, nodes []*ClusterNode, moves []SlotMove) *MigrationPlan {
+	return &MigrationPlan{
+		CreatedAt: time.Now(),
+		Addr:      addr,
+		Topology:  TopologyFingerprint(nodes),
+		Moves:     moves,
+	}
+}
+
+// KeyCount returns the total estimated keys of the plan
+func (p *MigrationPlan) KeyCount() int64 {
+	var count int64
+	for _, move := range p.Moves {
+		count += move.KeyCount
+	}
+	return count
+}
+
+// CheckTopology returns an error if the nodes differ from the topology the plan was computed from
+func (p *MigrationPlan) CheckTopology(nodes []*ClusterNode) error {
+	fingerprint := TopologyFingerprint(nodes)
+	if fingerprint != p.Topology {
+		return fmt.Errorf("topology changed since the plan was generated(%v, %v)", p.Topology, fingerprint)
+	}
+	return nil
+}
+
+// TopologyFingerprint hashes the ID, addr and slots of every master, ignoring transient flags
+func TopologyFingerprint(nodes []*ClusterNode) string {
+	lines := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if !node.IsMaster() {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s", node.ID, node.Addr, node.Slots.String()))
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+func isYAMLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// WritePlan writes the plan to path, as YAML if the extension is .yaml or .yml and as JSON otherwise
+func WritePlan(path string, plan *MigrationPlan) error {
+	var (
+		data []byte
+		err  error
+	)
+
+	if isYAMLFile(path) {
+		data, err = yaml.Marshal(plan)
+	} else {
+		data, err = json.MarshalIndent(plan, "", "  ")
+	}
+	if err != nil {
+		return fmt.Errorf("marshal plan: %v", err)
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// ReadPlan reads a plan written by WritePlan
+func ReadPlan(path string) (*MigrationPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &MigrationPlan{}
+	if isYAMLFile(path) {
+		err = yaml.Unmarshal(data, plan)
+	} else {
+		err = json.Unmarshal(data, plan)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal plan %s: %v", path, err)
+	}
+
+	return plan, nil
+}
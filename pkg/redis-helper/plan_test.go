@@ -0,0 +1,109 @@
+package rh
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteReadPlan(t *testing.T) {
+	nodes := []*ClusterNode{newTestMaster(t, "a", "0-8191"), newTestMaster(t, "b", "8192-16383")}
+	plan := NewMigrationPlan("a:6379", nodes, []SlotMove{
+		{Slot: 0, SrcNodeID: "a", SrcAddr: "a:6379", DstNodeID: "b", DstAddr: "b:6379", KeyCount: 10},
+		{Slot: 1, SrcNodeID: "a", SrcAddr: "a:6379", DstNodeID: "b", DstAddr: "b:6379"},
+	})
+	// yaml keeps the time with a second precision
+	plan.CreatedAt = time.Date(2024, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	for _, name := range []string{"plan.json", "plan.yaml", "plan.yml", "plan"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := WritePlan(path, plan); err != nil {
+				t.Fatalf("WritePlan error: %s", err)
+			}
+
+			read, err := ReadPlan(path)
+			if err != nil {
+				t.Fatalf("ReadPlan error: %s", err)
+			}
+			if !reflect.DeepEqual(read, plan) {
+				t.Errorf("ReadPlan =\n%+v\nwant\n%+v", read, plan)
+			}
+			if err := read.CheckTopology(nodes); err != nil {
+				t.Errorf("CheckTopology error: %s", err)
+			}
+		})
+	}
+}
+
+func TestTopologyFingerprint(t *testing.T) {
+	base := func(t *testing.T) []*ClusterNode {
+		return []*ClusterNode{newTestMaster(t, "a", "0-8191"), newTestMaster(t, "b", "8192-16383"),
+			{ID: "r", Addr: "r:6379", Role: RoleSlave, MasterID: "a", Slots: NewSlots()}}
+	}
+
+	tests := []struct {
+		name    string
+		change  func(t *testing.T, nodes []*ClusterNode) []*ClusterNode
+		changed bool
+	}{
+		{
+			name:   "unchanged",
+			change: func(t *testing.T, nodes []*ClusterNode) []*ClusterNode { return nodes },
+		},
+		{
+			name: "other order",
+			change: func(t *testing.T, nodes []*ClusterNode) []*ClusterNode {
+				return []*ClusterNode{nodes[2], nodes[1], nodes[0]}
+			},
+		},
+		{
+			name: "replica changed",
+			change: func(t *testing.T, nodes []*ClusterNode) []*ClusterNode {
+				nodes[2].MasterID, nodes[2].Addr = "b", "r:6380"
+				return nodes
+			},
+		},
+		{
+			name: "slot moved",
+			change: func(t *testing.T, nodes []*ClusterNode) []*ClusterNode {
+				nodes[0].Slots, nodes[1].Slots = mustParseSlots(t, "0-8190"), mustParseSlots(t, "8191-16383")
+				return nodes
+			},
+			changed: true,
+		},
+		{
+			name: "master addr changed",
+			change: func(t *testing.T, nodes []*ClusterNode) []*ClusterNode {
+				nodes[1].Addr = "b:6380"
+				return nodes
+			},
+			changed: true,
+		},
+		{
+			name: "failover",
+			change: func(t *testing.T, nodes []*ClusterNode) []*ClusterNode {
+				nodes[0].Role, nodes[0].MasterID, nodes[0].Slots = RoleSlave, "r", NewSlots()
+				nodes[2].Role, nodes[2].MasterID, nodes[2].Slots = RoleMaster, "-", mustParseSlots(t, "0-8191")
+				return nodes
+			},
+			changed: true,
+		},
+	}
+
+	want := TopologyFingerprint(base(t))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := tt.change(t, base(t))
+			if changed := TopologyFingerprint(nodes) != want; changed != tt.changed {
+				t.Errorf("TopologyFingerprint changed = %v, want %v", changed, tt.changed)
+			}
+
+			plan := &MigrationPlan{Topology: want}
+			if err := plan.CheckTopology(nodes); (err != nil) != tt.changed {
+				t.Errorf("CheckTopology error = %v, want error %v", err, tt.changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package rh
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type balanceNode struct {
+	node     *ClusterNode
+	weight   float64
+	expected int
+	// balance is the number of slots the node owns above its expected count, negative when it lacks slots
+	balance int
+}
+
+// PlanRebalance computes the moves spreading the slots of the masters in proportion to
+// their weight. weights maps node ID to weight, masters missing from it weigh 1, a weight
+// of 0 empties the master. Nothing moves when every master is within threshold percent
+// of its expected slots count, and only the slots above that count are moved.
+func PlanRebalance(nodes []*ClusterNode, weights map[string]float64, threshold float64) ([]SlotMove, error) {
+	var (
+		balanceNodes []*balanceNode
+		totalWeight  float64
+		totalSlots   int
+	)
+
+	if err := checkWeights(nodes, weights); err != nil {
+		return nil, err
+	}
+
+	for _, node := range nodes {
+		if !node.IsMaster() {
+			continue
+		}
+
+		if !node.IsHealthy() {
+			return nil, fmt.Errorf("master %s is not healthy, state:%s", node.ID, node.State)
+		}
+
+		weight, ok := weights[node.ID]
+		if !ok {
+			weight = 1
+		}
+
+		balanceNodes = append(balanceNodes, &balanceNode{node: node, weight: weight})
+		totalWeight += weight
+		totalSlots += node.Slots.SlotsCount()
+	}
+
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("total weight of masters is 0")
+	}
+
+	// give the slots left by rounding down to the largest remainders
+	sort.Slice(balanceNodes, func(i, j int) bool { return balanceNodes[i].node.ID < balanceNodes[j].node.ID })
+	remainders := make([]float64, len(balanceNodes))
+	assigned := 0
+	for i, bn := range balanceNodes {
+		expected := float64(totalSlots) * bn.weight / totalWeight
+		bn.expected = int(math.Floor(expected))
+		remainders[i] = expected - float64(bn.expected)
+		assigned += bn.expected
+	}
+
+	order := make([]int, len(balanceNodes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return remainders[order[i]] > remainders[order[j]] })
+	for _, i := range order[:totalSlots-assigned] {
+		balanceNodes[i].expected++
+	}
+
+	needRebalance := false
+	for _, bn := range balanceNodes {
+		count := bn.node.Slots.SlotsCount()
+		bn.balance = count - bn.expected
+
+		if bn.expected == 0 {
+			needRebalance = needRebalance || count > 0
+			continue
+		}
+
+		if math.Abs(float64(bn.balance))/float64(bn.expected)*100 > threshold {
+			needRebalance = true
+		}
+	}
+
+	if !needRebalance {
+		return nil, nil
+	}
+
+	return planBalanceMoves(balanceNodes), nil
+}
+
+func checkWeights(nodes []*ClusterNode, weights map[string]float64) error {
+	for id, weight := range weights {
+		node := getNodeByID(nodes, id)
+		if node == nil || !node.IsMaster() {
+			return fmt.Errorf("weighted node %s is not a master", id)
+		}
+		if weight < 0 {
+			return fmt.Errorf("weight of node %s is negative", id)
+		}
+	}
+	return nil
+}
+
+// planBalanceMoves moves the slots of the nodes with a positive balance to the ones with a negative balance
+func planBalanceMoves(balanceNodes []*balanceNode) []SlotMove {
+	var donors, receivers []*balanceNode
+	for _, bn := range balanceNodes {
+		if bn.balance > 0 {
+			donors = append(donors, bn)
+		} else if bn.balance < 0 {
+			receivers = append(receivers, bn)
+		}
+	}
+
+	sort.SliceStable(donors, func(i, j int) bool { return donors[i].balance > donors[j].balance })
+	sort.SliceStable(receivers, func(i, j int) bool { return receivers[i].balance < receivers[j].balance })
+
+	var moves []SlotMove
+	for _, donor := range donors {
+		slot := 0
+		for donor.balance > 0 && len(receivers) > 0 {
+			receiver := receivers[0]
+
+			for ; slot < TotalSlots; slot++ {
+				if donor.node.Slots.IsSet(slot) {
+					break
+				}
+			}
+
+			moves = append(moves, SlotMove{
+				Slot:      slot,
+				SrcNodeID: donor.node.ID,
+				SrcAddr:   donor.node.Addr,
+				DstNodeID: receiver.node.ID,
+				DstAddr:   receiver.node.Addr,
+			})
+			slot++
+
+			donor.balance--
+			receiver.balance++
+			if receiver.balance == 0 {
+				receivers = receivers[1:]
+			}
+		}
+	}
+
+	return moves
+}
+
+func getNodeByID(nodes []*ClusterNode, id string) *ClusterNode {
+	for _, node := range nodes {
+		if node.ID == id {
+			return node
+		}
+	}
+	return nil
+}
+
+// PlanDrain computes the moves emptying the master nodeID, each slot goes to
+// the remaining healthy master owning the fewest slots at that point.
+func PlanDrain(nodes []*ClusterNode, nodeID string) ([]SlotMove, error) {
+	drained := getNodeByID(nodes, nodeID)
+	if drained == nil {
+		return nil, fmt.Errorf("node %s not found", nodeID)
+	}
+	if !drained.IsMaster() {
+		return nil, fmt.Errorf("node %s is not a master", nodeID)
+	}
+
+	var receivers []*balanceNode
+	for _, node := range nodes {
+		if !node.IsMaster() || node.ID == nodeID || !node.IsHealthy() {
+			continue
+		}
+		receivers = append(receivers, &balanceNode{node: node, balance: node.Slots.SlotsCount()})
+	}
+
+	if len(receivers) == 0 {
+		return nil, fmt.Errorf("no other healthy master to receive the slots of %s", nodeID)
+	}
+
+	var moves []SlotMove
+	for slot := 0; slot < TotalSlots; slot++ {
+		if !drained.Slots.IsSet(slot) {
+			continue
+		}
+
+		receiver := receivers[0]
+		for _, bn := range receivers[1:] {
+			if bn.balance < receiver.balance {
+				receiver = bn
+			}
+		}
+		receiver.balance++
+
+		moves = append(moves, SlotMove{
+			Slot:      slot,
+			SrcNodeID: drained.ID,
+			SrcAddr:   drained.Addr,
+			DstNodeID: receiver.node.ID,
+			DstAddr:   receiver.node.Addr,
+		})
+	}
+
+	return moves, nil
+}
@@ -0,0 +1,270 @@
+package rh
+
+import (
+	"reflect"
+	"testing"
+)
+
+// newTestMaster returns a healthy master owning slots
+func newTestMaster(t *testing.T, id, slots string) *ClusterNode {
+	t.Helper()
+
+	return &ClusterNode{ID: id, Addr: id + ":6379", Role: RoleMaster, MasterID: "-", Slots: mustParseSlots(t, slots)}
+}
+
+// applyMoves applies moves to a copy of the slots of nodes and returns the resulting slots by node ID.
+// It fails if a slot moves twice, or if the source of a move does not own the slot at that point.
+func applyMoves(t *testing.T, nodes []*ClusterNode, moves []SlotMove) map[string]Slots {
+	t.Helper()
+
+	slots := make(map[string]Slots)
+	for _, node := range nodes {
+		slots[node.ID] = node.Slots.Clone()
+	}
+
+	moved := NewSlots()
+	for _, move := range moves {
+		if err := moved.Set(move.Slot); err != nil {
+			t.Fatalf("slot %d moved twice", move.Slot)
+		}
+
+		src, dst := getNodeByID(nodes, move.SrcNodeID), getNodeByID(nodes, move.DstNodeID)
+		if src == nil || dst == nil || !dst.IsMaster() {
+			t.Fatalf("move %+v between unknown nodes or to a replica", move)
+		}
+		if move.SrcAddr != src.Addr || move.DstAddr != dst.Addr {
+			t.Fatalf("move %+v addrs mismatch %s %s", move, src.Addr, dst.Addr)
+		}
+
+		if err := slots[move.SrcNodeID].Unset(move.Slot); err != nil {
+			t.Fatalf("slot %d moved from %s not owning it", move.Slot, move.SrcNodeID)
+		}
+		if err := slots[move.DstNodeID].Set(move.Slot); err != nil {
+			t.Fatalf("slot %d moved to %s already owning it", move.Slot, move.DstNodeID)
+		}
+	}
+
+	return slots
+}
+
+func slotsCounts(slots map[string]Slots) map[string]int {
+	counts := make(map[string]int, len(slots))
+	for id, s := range slots {
+		counts[id] = s.SlotsCount()
+	}
+	return counts
+}
+
+func TestPlanRebalance(t *testing.T) {
+	tests := []struct {
+		name      string
+		slots     map[string]string
+		weights   map[string]float64
+		threshold float64
+		moves     int
+		counts    map[string]int
+	}{
+		{
+			name:   "spread from one master",
+			slots:  map[string]string{"a": "0-16383", "b": "", "c": ""},
+			moves:  10922,
+			counts: map[string]int{"a": 5462, "b": 5461, "c": 5461},
+		},
+		{
+			name:    "weights",
+			slots:   map[string]string{"a": "0-5461", "b": "5462-10922", "c": "10923-16383"},
+			weights: map[string]float64{"a": 2},
+			moves:   2730,
+			counts:  map[string]int{"a": 8192, "b": 4096, "c": 4096},
+		},
+		{
+			name:    "weight 0 empties the master",
+			slots:   map[string]string{"a": "0-5461", "b": "5462-10922", "c": "10923-16383"},
+			weights: map[string]float64{"c": 0},
+			moves:   5461,
+			counts:  map[string]int{"a": 8192, "b": 8192, "c": 0},
+		},
+		{
+			name:      "within threshold",
+			slots:     map[string]string{"a": "0-8200", "b": "8201-16383"},
+			threshold: 1,
+			moves:     0,
+			counts:    map[string]int{"a": 8201, "b": 8183},
+		},
+		{
+			name:   "above threshold",
+			slots:  map[string]string{"a": "0-8200", "b": "8201-16383"},
+			moves:  9,
+			counts: map[string]int{"a": 8192, "b": 8192},
+		},
+		{
+			name:   "only the owned slots are spread",
+			slots:  map[string]string{"a": "0-99", "b": "100-109"},
+			moves:  45,
+			counts: map[string]int{"a": 55, "b": 55},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nodes []*ClusterNode
+			for _, id := range []string{"a", "b", "c"} {
+				if s, ok := tt.slots[id]; ok {
+					nodes = append(nodes, newTestMaster(t, id, s))
+				}
+			}
+			// replicas are ignored
+			nodes = append(nodes, &ClusterNode{ID: "r", Addr: "r:6379", Role: RoleSlave, MasterID: "a", Slots: NewSlots()})
+
+			moves, err := PlanRebalance(nodes, tt.weights, tt.threshold)
+			if err != nil {
+				t.Fatalf("PlanRebalance error: %s", err)
+			}
+			if len(moves) != tt.moves {
+				t.Errorf("PlanRebalance moves = %d, want %d", len(moves), tt.moves)
+			}
+
+			counts := slotsCounts(applyMoves(t, nodes, moves))
+			delete(counts, "r")
+			if !reflect.DeepEqual(counts, tt.counts) {
+				t.Errorf("PlanRebalance counts = %v, want %v", counts, tt.counts)
+			}
+		})
+	}
+}
+
+func TestPlanRebalanceInvalid(t *testing.T) {
+	unhealthy := newTestMaster(t, "c", "")
+	unhealthy.State = StatePFail
+
+	tests := []struct {
+		name    string
+		nodes   []*ClusterNode
+		weights map[string]float64
+	}{
+		{
+			name:  "unhealthy master",
+			nodes: []*ClusterNode{newTestMaster(t, "a", "0-16383"), unhealthy},
+		},
+		{
+			name:    "weighted node unknown",
+			nodes:   []*ClusterNode{newTestMaster(t, "a", "0-16383")},
+			weights: map[string]float64{"x": 1},
+		},
+		{
+			name:    "weighted replica",
+			nodes:   []*ClusterNode{newTestMaster(t, "a", "0-16383"), {ID: "r", Role: RoleSlave, MasterID: "a"}},
+			weights: map[string]float64{"r": 1},
+		},
+		{
+			name:    "negative weight",
+			nodes:   []*ClusterNode{newTestMaster(t, "a", "0-16383")},
+			weights: map[string]float64{"a": -1},
+		},
+		{
+			name:    "total weight 0",
+			nodes:   []*ClusterNode{newTestMaster(t, "a", "0-8191"), newTestMaster(t, "b", "8192-16383")},
+			weights: map[string]float64{"a": 0, "b": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if moves, err := PlanRebalance(tt.nodes, tt.weights, 0); err == nil {
+				t.Errorf("PlanRebalance = %d moves, want an error", len(moves))
+			}
+		})
+	}
+}
+
+func TestPlanDrain(t *testing.T) {
+	unhealthy := newTestMaster(t, "d", "")
+	unhealthy.State = StateFail
+
+	tests := []struct {
+		name   string
+		nodes  []*ClusterNode
+		counts map[string]int
+	}{
+		{
+			name:   "spread to the other masters",
+			nodes:  []*ClusterNode{newTestMaster(t, "a", "0-5461"), newTestMaster(t, "b", "5462-10922"), newTestMaster(t, "c", "10923-16383")},
+			counts: map[string]int{"a": 0, "b": 8192, "c": 8192},
+		},
+		{
+			name:   "the master owning the fewest slots first",
+			nodes:  []*ClusterNode{newTestMaster(t, "a", "0-99"), newTestMaster(t, "b", "100-16283"), newTestMaster(t, "c", "16284-16383")},
+			counts: map[string]int{"a": 0, "b": 16184, "c": 200},
+		},
+		{
+			name: "unhealthy masters and replicas receive nothing",
+			nodes: []*ClusterNode{newTestMaster(t, "a", "0-99"), newTestMaster(t, "b", "100-16383"), unhealthy,
+				{ID: "r", Addr: "r:6379", Role: RoleSlave, MasterID: "b", Slots: NewSlots()}},
+			counts: map[string]int{"a": 0, "b": 16384, "d": 0, "r": 0},
+		},
+		{
+			name:   "nothing to drain",
+			nodes:  []*ClusterNode{newTestMaster(t, "a", ""), newTestMaster(t, "b", "0-16383")},
+			counts: map[string]int{"a": 0, "b": 16384},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moves, err := PlanDrain(tt.nodes, "a")
+			if err != nil {
+				t.Fatalf("PlanDrain error: %s", err)
+			}
+
+			drained := getNodeByID(tt.nodes, "a")
+			if len(moves) != drained.Slots.SlotsCount() {
+				t.Errorf("PlanDrain moves = %d, want %d", len(moves), drained.Slots.SlotsCount())
+			}
+			for _, move := range moves {
+				if move.SrcNodeID != "a" {
+					t.Fatalf("move %+v not from the drained node", move)
+				}
+			}
+
+			counts := slotsCounts(applyMoves(t, tt.nodes, moves))
+			if !reflect.DeepEqual(counts, tt.counts) {
+				t.Errorf("PlanDrain counts = %v, want %v", counts, tt.counts)
+			}
+		})
+	}
+}
+
+func TestPlanDrainInvalid(t *testing.T) {
+	unhealthy := newTestMaster(t, "b", "")
+	unhealthy.State = StatePFail
+
+	tests := []struct {
+		name  string
+		nodes []*ClusterNode
+	}{
+		{
+			name:  "node not found",
+			nodes: []*ClusterNode{newTestMaster(t, "b", "0-16383")},
+		},
+		{
+			name:  "replica",
+			nodes: []*ClusterNode{newTestMaster(t, "b", "0-16383"), {ID: "a", Role: RoleSlave, MasterID: "b"}},
+		},
+		{
+			name:  "no other master",
+			nodes: []*ClusterNode{newTestMaster(t, "a", "0-16383")},
+		},
+		{
+			name:  "no other healthy master",
+			nodes: []*ClusterNode{newTestMaster(t, "a", "0-16383"), unhealthy},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if moves, err := PlanDrain(tt.nodes, "a"); err == nil {
+				t.Errorf("PlanDrain = %d moves, want an error", len(moves))
+			}
+		})
+	}
+}
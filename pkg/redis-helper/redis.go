@@ -2,9 +2,15 @@ package rh
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/geesugar/redis-tools/pkg/prom"
 	"github.com/geesugar/redis-tools/pkg/prom/redisprom"
 	"github.com/go-redis/redis/v8"
 	"github.com/prometheus/client_golang/prometheus"
@@ -18,12 +24,22 @@ const (
 	DefaultSubsystem = "redis"
 )
 
+// ConnOptions are the connection settings shared by the clients of every node of a cluster
+type ConnOptions struct {
+	Username  string
+	Password  string
+	TLSConfig *tls.Config
+	// Timeout bounds dialing, reading and writing, 0 keeps the go-redis defaults
+	Timeout time.Duration
+}
+
 type Client struct {
 	redis.UniversalClient
 
-	Host string
-	Port uint64
-	Addr string
+	Host    string
+	Port    uint64
+	Addr    string
+	Options *ConnOptions
 }
 
 func (c *Client) GetClusterNodes(ctx context.Context) (nodes []*ClusterNode, err error) {
@@ -57,73 +73,193 @@ func (c *Client) GetClusterInfo(ctx context.Context) (info *ClusterInfo, err err
 	if err != nil {
 		return
 	}
+
+	info.ID, err = c.Do(ctx, "cluster", "myid").Text()
+	if err != nil {
+		return nil, fmt.Errorf("cluster myid. addr:%s, err:%s", c.Addr, err)
+	}
 	return info, nil
 }
 
 func ParsePort(port string) (uint64, error) {
-	// string 2 uint64
-	var p uint64
-	for _, c := range port {
-		if c < '0' || c > '9' {
-			return 0, fmt.Errorf("invalid port")
-		}
-		p = p*10 + uint64(c-'0')
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q", port)
 	}
 	return p, nil
 }
 
+// ParseAddr splits host:port. IPv6 hosts may be bracketed as in [::1]:6379,
+// or bare as printed by CLUSTER NODES, the port being after the last colon.
 func ParseAddr(addr string) (host string, port uint64, err error) {
-	s := strings.Split(addr, ":")
-	if len(s) != 2 {
-		return "", 0, fmt.Errorf("invalid addr")
+	var portStr string
+	if strings.HasPrefix(addr, "[") {
+		host, portStr, err = net.SplitHostPort(addr)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid addr %q", addr)
+		}
+	} else {
+		i := strings.LastIndex(addr, ":")
+		if i < 0 {
+			return "", 0, fmt.Errorf("invalid addr %q", addr)
+		}
+		host, portStr = addr[:i], addr[i+1:]
 	}
 
-	port, err = ParsePort(s[1])
+	port, err = ParsePort(portStr)
 	if err != nil {
 		return "", 0, err
 	}
 
-	return s[0], port, nil
+	return host, port, nil
+}
+
+// JoinAddr joins host and port, bracketing IPv6 hosts
+func JoinAddr(host string, port uint64) string {
+	return net.JoinHostPort(host, strconv.FormatUint(port, 10))
 }
 
 func NewClient(ctx context.Context, addr, usr, passwd string) (cli *Client, err error) {
+	return NewClientWithOptions(ctx, addr, &ConnOptions{Username: usr, Password: passwd})
+}
+
+// NewClientWithOptions connects to addr, a nil opts connects without authentication nor TLS.
+// The command metrics of the client are labelled with addr only, see NewNodeClient.
+func NewClientWithOptions(ctx context.Context, addr string, opts *ConnOptions) (cli *Client, err error) {
+	return newClient(ctx, addr, opts, nodeLabels{})
+}
+
+// NewNodeClient connects to node, its command metrics are labelled with the ID and role of node
+func NewNodeClient(ctx context.Context, node *ClusterNode, opts *ConnOptions) (cli *Client, err error) {
+	return newClient(ctx, node.Addr, opts, nodeLabels{nodeID: node.ID, role: node.Role.String()})
+}
+
+func newClient(ctx context.Context, addr string, opts *ConnOptions, labels nodeLabels) (cli *Client, err error) {
+	if opts == nil {
+		opts = &ConnOptions{}
+	}
+
 	// parse addr
 	host, port, err := ParseAddr(addr)
 	if err != nil {
 		return nil, err
 	}
+	addr = JoinAddr(host, port)
 
-	uc, err := NewUniversalClient(ctx, addr, usr, passwd)
+	labels.addr = addr
+	uc, err := newUniversalClient(ctx, addr, opts, labels)
 	if err != nil {
 		return nil, err
 	}
 
+	addPoolStats(addr, uc)
+
 	return &Client{
 		UniversalClient: uc,
 		Host:            host,
 		Port:            port,
 		Addr:            addr,
+		Options:         opts,
 	}, nil
 }
 
+// Close closes the client and stops collecting the statistics of its pool
+func (c *Client) Close() error {
+	removePoolStats(c.Addr, c.UniversalClient)
+	return c.UniversalClient.Close()
+}
+
+var (
+	poolCollectorsMu sync.Mutex
+	// poolCollectors sum the pool statistics of the open clients of each addr
+	poolCollectors = make(map[string]*redisprom.Collector)
+)
+
+func addPoolStats(addr string, getter redisprom.StatGetter) {
+	poolCollectorsMu.Lock()
+	defer poolCollectorsMu.Unlock()
+
+	collector, ok := poolCollectors[addr]
+	if !ok {
+		collector = redisprom.NewCollectorWithLabels(DefaultNamespace, DefaultSubsystem, prometheus.Labels{"addr": addr})
+		if err := prometheus.Register(collector); err != nil {
+			fmt.Printf("register pool collector. addr:%s, err:%s\n", addr, err)
+		}
+		poolCollectors[addr] = collector
+	}
+
+	collector.Add(getter)
+}
+
+// removePoolStats unregisters the collector of addr once its last client is closed,
+// so the closed clients are not scraped
+func removePoolStats(addr string, getter redisprom.StatGetter) {
+	poolCollectorsMu.Lock()
+	defer poolCollectorsMu.Unlock()
+
+	collector, ok := poolCollectors[addr]
+	if !ok {
+		return
+	}
+
+	if collector.Remove(getter) == 0 {
+		prometheus.Unregister(collector)
+		delete(poolCollectors, addr)
+	}
+}
+
 func NewUniversalClient(ctx context.Context, addr, usr, pass string) (cli redis.UniversalClient, err error) {
-	cli = redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Username: usr,
-		Password: pass,
-	})
+	return NewUniversalClientWithOptions(ctx, addr, &ConnOptions{Username: usr, Password: pass})
+}
 
-	// register conn pool metrics collector
-	collector := redisprom.NewCollector(DefaultNamespace, DefaultSubsystem, cli)
-	prometheus.Register(collector)
+func NewUniversalClientWithOptions(ctx context.Context, addr string, opts *ConnOptions) (cli redis.UniversalClient, err error) {
+	return newUniversalClient(ctx, addr, opts, nodeLabels{addr: addr})
+}
 
-	cli.AddHook(redisprom.Hook())
+func newUniversalClient(ctx context.Context, addr string, opts *ConnOptions, labels nodeLabels) (cli redis.UniversalClient, err error) {
+	if opts == nil {
+		opts = &ConnOptions{}
+	}
+
+	options := &redis.Options{
+		Addr:      addr,
+		Username:  opts.Username,
+		Password:  opts.Password,
+		TLSConfig: opts.TLSConfig,
+	}
+
+	if opts.Timeout > 0 {
+		options.DialTimeout = opts.Timeout
+		options.ReadTimeout = opts.Timeout
+		options.WriteTimeout = opts.Timeout
+	}
+
+	cli = redis.NewClient(options)
 
 	err = cli.Ping(ctx).Err()
 
 	if err != nil {
 		_ = cli.Close()
+		return cli, err
 	}
 
-	return cli, err
+	cli.AddHook(redisprom.NewHook(prom.WithConstLabels(labels.constLabels())))
+
+	return cli, nil
+}
+
+// nodeLabels are the constant labels of the command metrics of a client, every client has the
+// same label names so that their metrics register side by side
+type nodeLabels struct {
+	addr   string
+	nodeID string
+	role   string
+}
+
+func (l nodeLabels) constLabels() map[string]string {
+	return map[string]string{
+		"addr":    l.addr,
+		"node_id": l.nodeID,
+		"role":    l.role,
+	}
 }
@@ -0,0 +1,46 @@
+package rh
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+const slotTagLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// slotTagsMaxAttempts bounds the random tags drawn by GenSlotTags, covering every slot takes
+// about TotalSlots*ln(TotalSlots) draws
+const slotTagsMaxAttempts = 100 * TotalSlots
+
+// GenSlotTags returns, for every slot, a hash tag of length letters hashing to it.
+// The same seed always returns the same tags, so the table can be regenerated offline.
+func GenSlotTags(seed int64, length int) ([TotalSlots]string, error) {
+	var tags [TotalSlots]string
+
+	// with fewer candidates than slots some slots could never be reached
+	if float64(length)*math.Log(float64(len(slotTagLetters))) < math.Log(4*TotalSlots) {
+		return tags, fmt.Errorf("tag length %d too short to cover %d slots", length, TotalSlots)
+	}
+
+	r := rand.New(rand.NewSource(seed))
+	b := make([]byte, length)
+	remaining := TotalSlots
+
+	for attempts := 0; remaining > 0; attempts++ {
+		if attempts == slotTagsMaxAttempts {
+			return tags, fmt.Errorf("no tag of length %d found for %d slots after %d attempts", length, remaining, attempts)
+		}
+
+		for i := range b {
+			b[i] = slotTagLetters[r.Intn(len(slotTagLetters))]
+		}
+
+		slot := KeySlot(b)
+		if tags[slot] == "" {
+			tags[slot] = string(b)
+			remaining--
+		}
+	}
+
+	return tags, nil
+}
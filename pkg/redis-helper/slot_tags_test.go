@@ -0,0 +1,41 @@
+package rh
+
+import "testing"
+
+func TestGenSlotTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		length  int
+		invalid bool
+	}{
+		{name: "too short", length: 2, invalid: true},
+		{name: "shortest", length: 3},
+		{name: "long", length: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags, err := GenSlotTags(1, tt.length)
+			if tt.invalid != (err != nil) {
+				t.Fatalf("GenSlotTags error = %v, want error %v", err, tt.invalid)
+			}
+			if tt.invalid {
+				return
+			}
+
+			for slot, tag := range tags {
+				if len(tag) != tt.length {
+					t.Fatalf("tag %q of slot %d, want length %d", tag, slot, tt.length)
+				}
+				if got := KeySlot([]byte(tag)); got != slot {
+					t.Fatalf("tag %q hashes to slot %d, want %d", tag, got, slot)
+				}
+			}
+
+			again, err := GenSlotTags(1, tt.length)
+			if err != nil || again != tags {
+				t.Errorf("GenSlotTags with the same seed returned other tags, err:%v", err)
+			}
+		})
+	}
+}
@@ -1,12 +1,18 @@
 package rh
 
 import (
+	"encoding/json"
 	"fmt"
+	"math/bits"
 	"strconv"
 	"strings"
 )
 
-type Slots []bool
+const slotsWords = TotalSlots / 64
+
+// Slots is a bitmap of the cluster slots. Like a slice it shares its bits on copy, use Clone
+// for an independent copy. A nil Slots reads as empty but can not be set.
+type Slots []uint64
 
 type SlotSlice struct {
 	Begin int
@@ -26,59 +32,86 @@ func (slice *SlotSlice) parse(s string) error {
 	}
 	slice.Begin = slot
 
-	// nolint
-	if len(nums) < 2 {
-		slice.End = slice.Begin
-		return nil
+	slice.End = slice.Begin
+	if len(nums) == 2 {
+		slot, err = strconv.Atoi(nums[1])
+		if err != nil {
+			return err
+		}
+		slice.End = slot
 	}
 
-	slot, err = strconv.Atoi(nums[1])
-	if err != nil {
-		return err
+	if slice.Begin < 0 || slice.End >= TotalSlots || slice.Begin > slice.End {
+		return fmt.Errorf("slot slice %s out of range", s)
 	}
-	slice.End = slot
 
 	return nil
 }
 
+func (slice SlotSlice) String() string {
+	if slice.Begin == slice.End {
+		return strconv.Itoa(slice.Begin)
+	}
+	return strconv.Itoa(slice.Begin) + "-" + strconv.Itoa(slice.End)
+}
+
 func NewSlots() Slots {
-	return make([]bool, TotalSlots)
+	return make(Slots, slotsWords)
+}
+
+// ParseSlots parses space separated slots and slot ranges, as printed by String: 0-100 200 300-400
+func ParseSlots(s string) (Slots, error) {
+	p := NewSlots()
+	if err := p.SetSlotSlice(s); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p Slots) word(i int) uint64 {
+	if i < len(p) {
+		return p[i]
+	}
+	return 0
 }
 
 func (p Slots) Set(slot int) error {
-	if slot < 0 || slot >= TotalSlots {
+	if slot < 0 || slot >= TotalSlots || len(p) < slotsWords {
 		return fmt.Errorf("slot %d out of range", slot)
 	}
-	if p[slot] {
+	if p.IsSet(slot) {
 		return fmt.Errorf("slot %d already set", slot)
 	}
-	p[slot] = true
+	p[slot>>6] |= 1 << (slot & 63)
 	return nil
 }
 
 func (p Slots) Unset(slot int) error {
-	if slot < 0 || slot >= TotalSlots {
+	if slot < 0 || slot >= TotalSlots || len(p) < slotsWords {
 		return fmt.Errorf("slot %d out of range", slot)
 	}
-	if !p[slot] {
+	if !p.IsSet(slot) {
 		return fmt.Errorf("slot %d already unset", slot)
 	}
 
-	p[slot] = false
+	p[slot>>6] &^= 1 << (slot & 63)
 	return nil
 }
 
 func (p Slots) IsSet(slot int) bool {
-	return p[slot]
+	if slot < 0 || slot >= TotalSlots {
+		return false
+	}
+	return p.word(slot>>6)&(1<<(slot&63)) != 0
 }
 
 func (p Slots) IsUnset(slot int) bool {
-	return !p[slot]
+	return !p.IsSet(slot)
 }
 
 func (p Slots) IsEmpty() bool {
-	for _, s := range p {
-		if s {
+	for _, w := range p {
+		if w != 0 {
 			return false
 		}
 	}
@@ -87,8 +120,8 @@ func (p Slots) IsEmpty() bool {
 }
 
 func (p Slots) IsAllSet() bool {
-	for _, s := range p {
-		if !s {
+	for i := 0; i < slotsWords; i++ {
+		if p.word(i) != ^uint64(0) {
 			return false
 		}
 	}
@@ -96,17 +129,21 @@ func (p Slots) IsAllSet() bool {
 	return true
 }
 
+// SetSlotSlice sets the space separated slots and slot ranges of slotSlice, slots already set are kept
 func (p Slots) SetSlotSlice(slotSlice string) error {
-	slice := SlotSlice{}
-	err := slice.parse(slotSlice)
-	if err != nil {
-		return err
-	}
+	// nodes without slots have an empty slot slice
+	for _, field := range strings.Fields(slotSlice) {
+		slice := SlotSlice{}
+		if err := slice.parse(field); err != nil {
+			return fmt.Errorf("invalid slot slice %q: %s", field, err)
+		}
 
-	for i := slice.Begin; i <= slice.End; i++ {
-		err = p.Set(i)
-		if err != nil {
-			return err
+		if len(p) < slotsWords {
+			return fmt.Errorf("slot slice %s out of range", field)
+		}
+
+		for i := slice.Begin; i <= slice.End; i++ {
+			p[i>>6] |= 1 << (i & 63)
 		}
 	}
 
@@ -115,66 +152,136 @@ func (p Slots) SetSlotSlice(slotSlice string) error {
 
 func (p Slots) SlotsCount() int {
 	count := 0
-	for _, s := range p {
-		if s {
-			count++
-		}
+	for _, w := range p {
+		count += bits.OnesCount64(w)
 	}
 
 	return count
 }
 
-func (p Slots) String() string {
-	var result strings.Builder
-	length := TotalSlots
-	inRange := false
-	start := 0
-
-	for i := 0; i < length; i++ {
-		if p[i] {
-			if !inRange {
-				inRange = true
-				start = i
-			}
-			// Handle the case where the last element is '*'
-			if i == length-1 {
-				appendSlotRange(&result, start, i)
-			}
-		} else {
-			if inRange {
-				appendSlotRange(&result, start, i-1)
-				inRange = false
+// Ranges returns the contiguous ranges of set slots in ascending order
+func (p Slots) Ranges() []SlotSlice {
+	var ranges []SlotSlice
+	for slot := 0; slot < TotalSlots; {
+		w := p.word(slot>>6) >> (slot & 63)
+		if w == 0 {
+			slot = (slot>>6 + 1) << 6
+			continue
+		}
+
+		begin := slot + bits.TrailingZeros64(w)
+		end := begin
+		for next := end + 1; next < TotalSlots; next = end + 1 {
+			// count the set bits from next to the end of its word, the shift brings in unset bits
+			ones := bits.TrailingZeros64(^(p.word(next>>6) >> (next & 63)))
+			if ones == 0 {
+				break
 			}
+			end += ones
 		}
+
+		ranges = append(ranges, SlotSlice{Begin: begin, End: end})
+		slot = end + 1
 	}
 
-	return strings.TrimSpace(result.String())
+	return ranges
 }
 
-// appendSlotRange handles and appends the range string to the result
-func appendSlotRange(result *strings.Builder, start, end int) {
-	if start == end {
-		result.WriteString(strconv.Itoa(start) + " ")
-	} else {
-		result.WriteString(strconv.Itoa(start) + "-" + strconv.Itoa(end) + " ")
+func (p Slots) String() string {
+	ranges := p.Ranges()
+	strs := make([]string, len(ranges))
+	for i, r := range ranges {
+		strs[i] = r.String()
 	}
+
+	return strings.Join(strs, " ")
 }
 
-func (p Slots) Compare(other Slots) (bool, string) {
-	leakSlots := NewSlots()
-	extraSlots := NewSlots()
+func (p Slots) Clone() Slots {
+	clone := NewSlots()
+	copy(clone, p)
+	return clone
+}
 
-	for i := 0; i < TotalSlots; i++ {
-		if p[i] && !other[i] {
-			extraSlots[i] = true
-		} else if !p[i] && other[i] {
-			leakSlots[i] = true
+func (p Slots) Equal(other Slots) bool {
+	for i := 0; i < slotsWords; i++ {
+		if p.word(i) != other.word(i) {
+			return false
 		}
 	}
 
-	if leakSlots.IsEmpty() && extraSlots.IsEmpty() {
-		return true, ""
+	return true
+}
+
+// Union returns the slots set in p or other
+func (p Slots) Union(other Slots) Slots {
+	result := NewSlots()
+	for i := range result {
+		result[i] = p.word(i) | other.word(i)
+	}
+	return result
+}
+
+// Intersect returns the slots set in both p and other
+func (p Slots) Intersect(other Slots) Slots {
+	result := NewSlots()
+	for i := range result {
+		result[i] = p.word(i) & other.word(i)
+	}
+	return result
+}
+
+// Difference returns the slots of p not set in other
+func (p Slots) Difference(other Slots) Slots {
+	result := NewSlots()
+	for i := range result {
+		result[i] = p.word(i) &^ other.word(i)
+	}
+	return result
+}
+
+// Diff returns the slots of other missing from p, and the slots of p not in other
+func (p Slots) Diff(other Slots) (missing, extra Slots) {
+	return other.Difference(p), p.Difference(other)
+}
+
+// SlotsDiff is the difference of slots with expected ones, Missing are expected but not set
+// and Extra are set but not expected
+type SlotsDiff struct {
+	Missing Slots `json:"missing"`
+	Extra   Slots `json:"extra"`
+}
+
+func (d SlotsDiff) IsEmpty() bool {
+	return d.Missing.IsEmpty() && d.Extra.IsEmpty()
+}
+
+func (d SlotsDiff) String() string {
+	return fmt.Sprintf("-[%s] +[%s]", d.Missing.String(), d.Extra.String())
+}
+
+// Compare returns the difference of p with the expected slots of other
+func (p Slots) Compare(other Slots) SlotsDiff {
+	missing, extra := p.Diff(other)
+	return SlotsDiff{Missing: missing, Extra: extra}
+}
+
+// MarshalJSON encodes the slots as their String
+func (p Slots) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+func (p *Slots) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	slots, err := ParseSlots(s)
+	if err != nil {
+		return err
 	}
 
-	return false, fmt.Sprintf("-[%s] +[%s]", leakSlots.String(), extraSlots.String())
+	*p = slots
+	return nil
 }
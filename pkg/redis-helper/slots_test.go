@@ -0,0 +1,242 @@
+package rh
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func mustParseSlots(t *testing.T, s string) Slots {
+	t.Helper()
+
+	slots, err := ParseSlots(s)
+	if err != nil {
+		t.Fatalf("ParseSlots(%q) error: %s", s, err)
+	}
+	return slots
+}
+
+func TestParseSlots(t *testing.T) {
+	tests := []struct {
+		s       string
+		str     string
+		count   int
+		invalid bool
+	}{
+		{s: "", str: "", count: 0},
+		{s: "0", str: "0", count: 1},
+		{s: "16383", str: "16383", count: 1},
+		{s: "0-16383", str: "0-16383", count: TotalSlots},
+		{s: "0-100 200 300-400", str: "0-100 200 300-400", count: 203},
+		// ranges are merged and sorted
+		{s: "300-400 0-100 200", str: "0-100 200 300-400", count: 203},
+		{s: "0-5 3 6 7-9", str: "0-9", count: 10},
+		{s: "  1   2  ", str: "1-2", count: 2},
+		// word boundaries of the bitmap
+		{s: "63 64", str: "63-64", count: 2},
+		{s: "62-65 127-128", str: "62-65 127-128", count: 6},
+		{s: "16384", invalid: true},
+		{s: "0-16384", invalid: true},
+		{s: "-1", invalid: true},
+		{s: "10-0", invalid: true},
+		{s: "a", invalid: true},
+		{s: "1-b", invalid: true},
+	}
+
+	for _, tt := range tests {
+		slots, err := ParseSlots(tt.s)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("ParseSlots(%q) = %s, want an error", tt.s, slots)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSlots(%q) error: %s", tt.s, err)
+			continue
+		}
+
+		if str := slots.String(); str != tt.str {
+			t.Errorf("ParseSlots(%q).String() = %q, want %q", tt.s, str, tt.str)
+		}
+		if count := slots.SlotsCount(); count != tt.count {
+			t.Errorf("ParseSlots(%q).SlotsCount() = %d, want %d", tt.s, count, tt.count)
+		}
+
+		// String parses back to the same slots
+		if again := mustParseSlots(t, slots.String()); !again.Equal(slots) {
+			t.Errorf("ParseSlots(%q) round-trip = %s, want %s", tt.s, again, slots)
+		}
+	}
+}
+
+func TestSlotsRanges(t *testing.T) {
+	tests := []struct {
+		s      string
+		ranges []SlotSlice
+	}{
+		{s: "", ranges: nil},
+		{s: "0", ranges: []SlotSlice{{0, 0}}},
+		{s: "0-16383", ranges: []SlotSlice{{0, 16383}}},
+		{s: "0-63", ranges: []SlotSlice{{0, 63}}},
+		{s: "63-64", ranges: []SlotSlice{{63, 64}}},
+		{s: "0-127 129", ranges: []SlotSlice{{0, 127}, {129, 129}}},
+		{s: "1 3 5", ranges: []SlotSlice{{1, 1}, {3, 3}, {5, 5}}},
+		{s: "100-200 16383", ranges: []SlotSlice{{100, 200}, {16383, 16383}}},
+	}
+
+	for _, tt := range tests {
+		if ranges := mustParseSlots(t, tt.s).Ranges(); !reflect.DeepEqual(ranges, tt.ranges) {
+			t.Errorf("Ranges of %q = %v, want %v", tt.s, ranges, tt.ranges)
+		}
+	}
+}
+
+func TestSlotsSetOperations(t *testing.T) {
+	tests := []struct {
+		a, b       string
+		union      string
+		intersect  string
+		difference string
+		equal      bool
+	}{
+		{a: "", b: "", union: "", intersect: "", difference: "", equal: true},
+		{a: "0-100", b: "", union: "0-100", intersect: "", difference: "0-100"},
+		{a: "", b: "0-100", union: "0-100", intersect: "", difference: ""},
+		{a: "0-100", b: "50-150", union: "0-150", intersect: "50-100", difference: "0-49"},
+		{a: "0-100", b: "0-100", union: "0-100", intersect: "0-100", difference: "", equal: true},
+		{a: "0-10 20-30", b: "5-25", union: "0-30", intersect: "5-10 20-25", difference: "0-4 26-30"},
+		{a: "0-8191", b: "8192-16383", union: "0-16383", intersect: "", difference: "0-8191"},
+	}
+
+	for _, tt := range tests {
+		a, b := mustParseSlots(t, tt.a), mustParseSlots(t, tt.b)
+
+		if union := a.Union(b).String(); union != tt.union {
+			t.Errorf("%q union %q = %q, want %q", tt.a, tt.b, union, tt.union)
+		}
+		if intersect := a.Intersect(b).String(); intersect != tt.intersect {
+			t.Errorf("%q intersect %q = %q, want %q", tt.a, tt.b, intersect, tt.intersect)
+		}
+		if difference := a.Difference(b).String(); difference != tt.difference {
+			t.Errorf("%q difference %q = %q, want %q", tt.a, tt.b, difference, tt.difference)
+		}
+		if equal := a.Equal(b); equal != tt.equal {
+			t.Errorf("%q equal %q = %v, want %v", tt.a, tt.b, equal, tt.equal)
+		}
+
+		// Diff and Compare are Difference both ways
+		missing, extra := a.Diff(b)
+		if !missing.Equal(b.Difference(a)) || !extra.Equal(a.Difference(b)) {
+			t.Errorf("%q diff %q = %s, %s", tt.a, tt.b, missing, extra)
+		}
+		if empty := a.Compare(b).IsEmpty(); empty != tt.equal {
+			t.Errorf("%q compare %q IsEmpty = %v, want %v", tt.a, tt.b, empty, tt.equal)
+		}
+		if empty := a.Difference(b).IsEmpty(); empty != (tt.difference == "") {
+			t.Errorf("%q difference %q IsEmpty = %v", tt.a, tt.b, empty)
+		}
+
+		// the operands are left unchanged
+		if a.String() != mustParseSlots(t, tt.a).String() || b.String() != mustParseSlots(t, tt.b).String() {
+			t.Errorf("%q and %q modified to %q and %q", tt.a, tt.b, a, b)
+		}
+	}
+}
+
+func TestSlotsNil(t *testing.T) {
+	var p Slots
+
+	if !p.IsEmpty() || p.SlotsCount() != 0 || p.String() != "" || p.IsSet(0) {
+		t.Errorf("nil slots not empty: %s", p)
+	}
+	if !p.Equal(NewSlots()) {
+		t.Errorf("nil slots not equal to empty slots")
+	}
+	if union := p.Union(mustParseSlots(t, "1-2")).String(); union != "1-2" {
+		t.Errorf("nil union 1-2 = %q, want 1-2", union)
+	}
+	if err := p.Set(0); err == nil {
+		t.Errorf("Set on nil slots, want an error")
+	}
+}
+
+func TestSlotsSetUnset(t *testing.T) {
+	p := NewSlots()
+
+	if err := p.Set(100); err != nil {
+		t.Fatalf("Set(100) error: %s", err)
+	}
+	if !p.IsSet(100) || p.IsUnset(100) {
+		t.Errorf("slot 100 not set")
+	}
+	if err := p.Set(100); err == nil {
+		t.Errorf("Set(100) twice, want an error")
+	}
+
+	if err := p.Unset(100); err != nil {
+		t.Fatalf("Unset(100) error: %s", err)
+	}
+	if !p.IsEmpty() {
+		t.Errorf("slots %s not empty", p)
+	}
+	if err := p.Unset(100); err == nil {
+		t.Errorf("Unset(100) twice, want an error")
+	}
+
+	if !mustParseSlots(t, "0-16383").IsAllSet() || mustParseSlots(t, "0-16382").IsAllSet() {
+		t.Errorf("IsAllSet mismatch")
+	}
+
+	clone := p.Clone()
+	if err := clone.Set(1); err != nil {
+		t.Fatalf("Set(1) error: %s", err)
+	}
+	if p.IsSet(1) {
+		t.Errorf("clone shares its bits")
+	}
+}
+
+func TestSlotsJSON(t *testing.T) {
+	type node struct {
+		Slots Slots `json:"slots"`
+	}
+
+	tests := []struct {
+		s    string
+		json string
+	}{
+		{s: "", json: `{"slots":""}`},
+		{s: "0-100 200 300-400", json: `{"slots":"0-100 200 300-400"}`},
+		{s: "0-16383", json: `{"slots":"0-16383"}`},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(node{Slots: mustParseSlots(t, tt.s)})
+		if err != nil {
+			t.Fatalf("Marshal %q error: %s", tt.s, err)
+		}
+		if string(data) != tt.json {
+			t.Errorf("Marshal %q = %s, want %s", tt.s, data, tt.json)
+		}
+
+		decoded := node{}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Unmarshal %s error: %s", data, err)
+		}
+		if !decoded.Slots.Equal(mustParseSlots(t, tt.s)) {
+			t.Errorf("Unmarshal %s = %s, want %s", data, decoded.Slots, tt.s)
+		}
+	}
+
+	// a nil bitmap marshals as empty
+	if data, err := json.Marshal(node{}); err != nil || string(data) != `{"slots":""}` {
+		t.Errorf("Marshal nil slots = %s, %v", data, err)
+	}
+
+	for _, data := range []string{`{"slots":"16384"}`, `{"slots":"a-b"}`, `{"slots":[1,2]}`} {
+		if err := json.Unmarshal([]byte(data), &node{}); err == nil {
+			t.Errorf("Unmarshal %s, want an error", data)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package rh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Snapshot is the topology of a cluster at CreatedAt, as seen by the node of Addr and by every node it knows
+type Snapshot struct {
+	CreatedAt time.Time `json:"created_at"`
+	Addr      string    `json:"addr"`
+	// Info and Nodes are the CLUSTER INFO and CLUSTER NODES of the node of Addr
+	Info  *ClusterInfo    `json:"info"`
+	Nodes []*SnapshotNode `json:"nodes"`
+	Views []*SnapshotView `json:"views"`
+}
+
+// SnapshotView is the CLUSTER INFO and CLUSTER NODES of one node, Error is set if it did not answer
+type SnapshotView struct {
+	NodeID string          `json:"node_id"`
+	Addr   string          `json:"addr"`
+	Error  string          `json:"error,omitempty"`
+	Info   *ClusterInfo    `json:"info,omitempty"`
+	Nodes  []*SnapshotNode `json:"nodes,omitempty"`
+}
+
+// SnapshotNode is one line of CLUSTER NODES
+type SnapshotNode struct {
+	ID        string         `json:"id"`
+	Addr      string         `json:"addr"`
+	Hostname  string         `json:"hostname,omitempty"`
+	Role      string         `json:"role"`
+	MasterID  string         `json:"master_id,omitempty"`
+	Flags     []string       `json:"flags"`
+	Epoch     int64          `json:"epoch"`
+	LinkState string         `json:"link_state"`
+	Slots     Slots          `json:"slots"`
+	Migrating map[int]string `json:"migrating,omitempty"`
+	Importing map[int]string `json:"importing,omitempty"`
+}
+
+func (n *SnapshotNode) IsMaster() bool { return n.Role == RoleMaster.String() }
+
+func NewSnapshotNodes(nodes []*ClusterNode) []*SnapshotNode {
+	snapshotNodes := make([]*SnapshotNode, 0, len(nodes))
+	for _, node := range nodes {
+		masterID := node.MasterID
+		if masterID == "-" {
+			masterID = ""
+		}
+
+		snapshotNodes = append(snapshotNodes, &SnapshotNode{
+			ID:        node.ID,
+			Addr:      node.Addr,
+			Hostname:  node.Hostname,
+			Role:      node.Role.String(),
+			MasterID:  masterID,
+			Flags:     node.Flags,
+			Epoch:     node.Epoch,
+			LinkState: node.LinkState,
+			Slots:     node.Slots,
+			Migrating: node.Migrating,
+			Importing: node.Importing,
+		})
+	}
+
+	sort.Slice(snapshotNodes, func(i, j int) bool { return snapshotNodes[i].ID < snapshotNodes[j].ID })
+
+	return snapshotNodes
+}
+
+// TakeSnapshot queries CLUSTER INFO and CLUSTER NODES of addr, then of every node it knows.
+// The nodes failing to answer are recorded in their view rather than failing the snapshot.
+func TakeSnapshot(ctx context.Context, addr string, opts *ConnOptions) (*Snapshot, error) {
+	info, nodes, err := getTopology(ctx, addr, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{
+		CreatedAt: time.Now(),
+		Addr:      addr,
+		Info:      info,
+		Nodes:     NewSnapshotNodes(nodes),
+	}
+
+	for _, node := range snapshot.Nodes {
+		view := &SnapshotView{NodeID: node.ID, Addr: node.Addr}
+		snapshot.Views = append(snapshot.Views, view)
+
+		if containsFlag(node.Flags, "noaddr") {
+			view.Error = "noaddr"
+			continue
+		}
+
+		info, nodes, err := getTopology(ctx, node.Addr, opts)
+		if err != nil {
+			view.Error = err.Error()
+			continue
+		}
+
+		view.Info = info
+		view.Nodes = NewSnapshotNodes(nodes)
+	}
+
+	return snapshot, nil
+}
+
+func getTopology(ctx context.Context, addr string, opts *ConnOptions) (*ClusterInfo, []*ClusterNode, error) {
+	cli, err := NewClientWithOptions(ctx, addr, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("new client. addr:%s, err:%s", addr, err)
+	}
+	defer cli.Close()
+
+	info, err := cli.GetClusterInfo(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get cluster info. addr:%s, err:%s", addr, err)
+	}
+
+	nodes, err := cli.GetClusterNodes(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get cluster nodes. addr:%s, err:%s", addr, err)
+	}
+
+	return info, nodes, nil
+}
+
+func containsFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteSnapshot writes the snapshot to path, as YAML if the extension is .yaml or .yml and as JSON otherwise
+func WriteSnapshot(path string, snapshot *Snapshot) error {
+	var (
+		data []byte
+		err  error
+	)
+
+	if isYAMLFile(path) {
+		data, err = yaml.Marshal(snapshot)
+	} else {
+		data, err = json.MarshalIndent(snapshot, "", "  ")
+	}
+	if err != nil {
+		return fmt.Errorf("marshal snapshot: %v", err)
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot
+func ReadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{}
+	if isYAMLFile(path) {
+		err = yaml.Unmarshal(data, snapshot)
+	} else {
+		err = json.Unmarshal(data, snapshot)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal snapshot %s: %v", path, err)
+	}
+
+	return snapshot, nil
+}
+
+// PlanRestore returns the moves giving back to the masters of nodes the slots they owned in the snapshot.
+// The masters of the snapshot are matched by ID, or by addr if their ID is unknown.
+func PlanRestore(snapshot *Snapshot, nodes []*ClusterNode) ([]SlotMove, error) {
+	served := NewSlots()
+	for _, node := range nodes {
+		if node.IsMaster() {
+			served = served.Union(node.Slots)
+		}
+	}
+
+	owners := make(map[string]*SnapshotNode)
+	var moves []SlotMove
+	for _, owner := range snapshot.Nodes {
+		if owner.Slots.IsEmpty() {
+			continue
+		}
+
+		node := getNodeByID(nodes, owner.ID)
+		if node == nil {
+			node = getNodeByAddr(nodes, owner.Addr)
+		}
+		if node == nil {
+			return nil, fmt.Errorf("node %s %s of the snapshot not found", owner.ID, owner.Addr)
+		}
+		if !node.IsMaster() {
+			return nil, fmt.Errorf("node %s %s is not a master", node.ID, node.Addr)
+		}
+		if other, ok := owners[node.ID]; ok {
+			return nil, fmt.Errorf("node %s %s matches both %s and %s of the snapshot", node.ID, node.Addr, other.ID, owner.ID)
+		}
+		owners[node.ID] = owner
+
+		if unserved := owner.Slots.Difference(served); !unserved.IsEmpty() {
+			return nil, fmt.Errorf("slots not served by any master: %s", unserved)
+		}
+
+		for _, src := range nodes {
+			if !src.IsMaster() || src.ID == node.ID {
+				continue
+			}
+
+			slots := owner.Slots.Intersect(src.Slots)
+			for slot := 0; slot < TotalSlots; slot++ {
+				if !slots.IsSet(slot) {
+					continue
+				}
+
+				moves = append(moves, SlotMove{
+					Slot:      slot,
+					SrcNodeID: src.ID,
+					SrcAddr:   src.Addr,
+					DstNodeID: node.ID,
+					DstAddr:   node.Addr,
+				})
+			}
+		}
+	}
+
+	sort.Slice(moves, func(i, j int) bool { return moves[i].Slot < moves[j].Slot })
+
+	return moves, nil
+}
+
+func getNodeByAddr(nodes []*ClusterNode, addr string) *ClusterNode {
+	for _, node := range nodes {
+		if node.Addr == addr {
+			return node
+		}
+	}
+	return nil
+}
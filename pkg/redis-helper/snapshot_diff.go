@@ -0,0 +1,180 @@
+package rh
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	ChangeAdded        = "added"
+	ChangeRemoved      = "removed"
+	ChangeAddr         = "addr"
+	ChangeRole         = "role"
+	ChangeFailover     = "failover"
+	ChangeMasterID     = "master_id"
+	ChangeEpoch        = "epoch"
+	ChangeCurrentEpoch = "current_epoch"
+	ChangeSlots        = "slots"
+)
+
+// SnapshotDiff is the topology change between the snapshots taken at From and To
+type SnapshotDiff struct {
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Changes []TopologyChange `json:"changes"`
+	// Movements are the slots which changed owner, grouped by source and destination
+	Movements []SlotsMovement `json:"movements"`
+}
+
+// TopologyChange is one field of a node which changed from Old to New
+type TopologyChange struct {
+	Kind   string `json:"kind"`
+	NodeID string `json:"node_id,omitempty"`
+	Addr   string `json:"addr,omitempty"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// SlotsMovement are slots owned by From in the old snapshot and by To in the new one,
+// From or To is empty for slots which were or became not covered
+type SlotsMovement struct {
+	From     string `json:"from"`
+	FromAddr string `json:"from_addr"`
+	To       string `json:"to"`
+	ToAddr   string `json:"to_addr"`
+	Slots    Slots  `json:"slots"`
+}
+
+func (d *SnapshotDiff) IsEmpty() bool {
+	return len(d.Changes) == 0 && len(d.Movements) == 0
+}
+
+// DiffSnapshots compares the topology of old and cur, as seen by the node each snapshot was taken from
+func DiffSnapshots(old, cur *Snapshot) *SnapshotDiff {
+	diff := &SnapshotDiff{From: old.CreatedAt, To: cur.CreatedAt}
+
+	if old.Info != nil && cur.Info != nil && old.Info.CurrentEpoch != cur.Info.CurrentEpoch {
+		diff.Changes = append(diff.Changes, TopologyChange{
+			Kind: ChangeCurrentEpoch,
+			Old:  fmt.Sprint(old.Info.CurrentEpoch),
+			New:  fmt.Sprint(cur.Info.CurrentEpoch),
+		})
+	}
+
+	oldNodes := snapshotNodeMap(old.Nodes)
+	newNodes := snapshotNodeMap(cur.Nodes)
+
+	ids := make([]string, 0, len(oldNodes)+len(newNodes))
+	for id := range oldNodes {
+		ids = append(ids, id)
+	}
+	for id := range newNodes {
+		if _, ok := oldNodes[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		diff.Changes = append(diff.Changes, diffSnapshotNode(oldNodes[id], newNodes[id])...)
+	}
+
+	diff.Movements = slotsMovements(old.Nodes, cur.Nodes)
+
+	return diff
+}
+
+func snapshotNodeMap(nodes []*SnapshotNode) map[string]*SnapshotNode {
+	m := make(map[string]*SnapshotNode, len(nodes))
+	for _, node := range nodes {
+		m[node.ID] = node
+	}
+	return m
+}
+
+// diffSnapshotNode compares the old and current states of a node, either may be nil
+func diffSnapshotNode(old, cur *SnapshotNode) []TopologyChange {
+	switch {
+	case old == nil:
+		return []TopologyChange{{Kind: ChangeAdded, NodeID: cur.ID, Addr: cur.Addr, Old: "-", New: cur.Role}}
+	case cur == nil:
+		return []TopologyChange{{Kind: ChangeRemoved, NodeID: old.ID, Addr: old.Addr, Old: old.Role, New: "-"}}
+	}
+
+	var changes []TopologyChange
+	add := func(kind, oldValue, newValue string) {
+		changes = append(changes, TopologyChange{Kind: kind, NodeID: cur.ID, Addr: cur.Addr, Old: oldValue, New: newValue})
+	}
+
+	if old.Addr != cur.Addr {
+		add(ChangeAddr, old.Addr, cur.Addr)
+	}
+
+	if old.Role != cur.Role {
+		add(ChangeRole, old.Role, cur.Role)
+		// a replica promoted in place of its master
+		if !old.IsMaster() && cur.IsMaster() && old.MasterID != "" {
+			add(ChangeFailover, old.MasterID, cur.ID)
+		}
+	} else if old.MasterID != cur.MasterID {
+		add(ChangeMasterID, old.MasterID, cur.MasterID)
+	}
+
+	if old.Epoch != cur.Epoch {
+		add(ChangeEpoch, fmt.Sprint(old.Epoch), fmt.Sprint(cur.Epoch))
+	}
+
+	// the slots lost and gained are detailed by the movements
+	if slotsDiff := cur.Slots.Compare(old.Slots); !slotsDiff.IsEmpty() {
+		add(ChangeSlots, old.Slots.String(), cur.Slots.String())
+	}
+
+	return changes
+}
+
+// slotsMovements groups the slots which changed owner by old and new owner
+func slotsMovements(oldNodes, newNodes []*SnapshotNode) []SlotsMovement {
+	var movements []SlotsMovement
+	add := func(from, to *SnapshotNode, slots Slots) {
+		if slots.IsEmpty() {
+			return
+		}
+
+		movement := SlotsMovement{Slots: slots}
+		if from != nil {
+			movement.From, movement.FromAddr = from.ID, from.Addr
+		}
+		if to != nil {
+			movement.To, movement.ToAddr = to.ID, to.Addr
+		}
+		movements = append(movements, movement)
+	}
+
+	oldCovered, newCovered := NewSlots(), NewSlots()
+	for _, node := range oldNodes {
+		oldCovered = oldCovered.Union(node.Slots)
+	}
+	for _, node := range newNodes {
+		newCovered = newCovered.Union(node.Slots)
+	}
+
+	for _, from := range oldNodes {
+		if from.Slots.IsEmpty() {
+			continue
+		}
+
+		for _, to := range newNodes {
+			if to.ID != from.ID {
+				add(from, to, from.Slots.Intersect(to.Slots))
+			}
+		}
+		add(from, nil, from.Slots.Difference(newCovered))
+	}
+
+	for _, to := range newNodes {
+		add(nil, to, to.Slots.Difference(oldCovered))
+	}
+
+	return movements
+}
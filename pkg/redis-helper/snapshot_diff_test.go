@@ -0,0 +1,143 @@
+package rh
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+const (
+	// testReplicaID is the replica of testID1 in testdata/snapshot.json, testID2 and testID3 being the other masters
+	testReplicaID = "a1d1c1f8c8ffb5a1b0e2c3d4e5f60718293a4b5c"
+	testNewID     = "d4e5f60718293a4b5ca1d1c1f8c8ffb5a1b0e2c3"
+)
+
+func readTestSnapshot(t *testing.T) *Snapshot {
+	t.Helper()
+
+	snapshot, err := ReadSnapshot("testdata/snapshot.json")
+	if err != nil {
+		t.Fatalf("ReadSnapshot error: %s", err)
+	}
+	return snapshot
+}
+
+func getSnapshotNode(t *testing.T, snapshot *Snapshot, id string) *SnapshotNode {
+	t.Helper()
+
+	for _, node := range snapshot.Nodes {
+		if node.ID == id {
+			return node
+		}
+	}
+	t.Fatalf("snapshot node %s not found", id)
+	return nil
+}
+
+func formatMovements(movements []SlotsMovement) []string {
+	var strs []string
+	for _, m := range movements {
+		strs = append(strs, fmt.Sprintf("%s->%s %s", m.From, m.To, m.Slots))
+	}
+	return strs
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(t *testing.T, cur *Snapshot)
+		changes   []TopologyChange
+		movements []string
+	}{
+		{
+			name:   "unchanged",
+			change: func(t *testing.T, cur *Snapshot) {},
+		},
+		{
+			name: "moved slot",
+			change: func(t *testing.T, cur *Snapshot) {
+				cur.Info.CurrentEpoch = 4
+				getSnapshotNode(t, cur, testID1).Slots = mustParseSlots(t, "0-99 101-5460")
+				b := getSnapshotNode(t, cur, testID2)
+				b.Slots, b.Epoch = mustParseSlots(t, "100 5461-10922"), 4
+			},
+			changes: []TopologyChange{
+				{Kind: ChangeCurrentEpoch, Old: "3", New: "4"},
+				{Kind: ChangeSlots, NodeID: testID1, Addr: "127.0.0.1:30001", Old: "0-5460", New: "0-99 101-5460"},
+				{Kind: ChangeEpoch, NodeID: testID2, Addr: "127.0.0.1:30002", Old: "2", New: "4"},
+				{Kind: ChangeSlots, NodeID: testID2, Addr: "127.0.0.1:30002", Old: "5461-10922", New: "100 5461-10922"},
+			},
+			movements: []string{testID1 + "->" + testID2 + " 100"},
+		},
+		{
+			name: "failover",
+			change: func(t *testing.T, cur *Snapshot) {
+				a := getSnapshotNode(t, cur, testID1)
+				r := getSnapshotNode(t, cur, testReplicaID)
+				a.Role, a.MasterID, a.Slots, a.Epoch = "slave", testReplicaID, NewSlots(), 4
+				r.Role, r.MasterID, r.Slots, r.Epoch = "master", "", mustParseSlots(t, "0-5460"), 4
+			},
+			changes: []TopologyChange{
+				{Kind: ChangeRole, NodeID: testID1, Addr: "127.0.0.1:30001", Old: "master", New: "slave"},
+				{Kind: ChangeEpoch, NodeID: testID1, Addr: "127.0.0.1:30001", Old: "1", New: "4"},
+				{Kind: ChangeSlots, NodeID: testID1, Addr: "127.0.0.1:30001", Old: "0-5460", New: ""},
+				{Kind: ChangeRole, NodeID: testReplicaID, Addr: "127.0.0.1:30004", Old: "slave", New: "master"},
+				{Kind: ChangeFailover, NodeID: testReplicaID, Addr: "127.0.0.1:30004", Old: testID1, New: testReplicaID},
+				{Kind: ChangeEpoch, NodeID: testReplicaID, Addr: "127.0.0.1:30004", Old: "1", New: "4"},
+				{Kind: ChangeSlots, NodeID: testReplicaID, Addr: "127.0.0.1:30004", Old: "", New: "0-5460"},
+			},
+			movements: []string{testID1 + "->" + testReplicaID + " 0-5460"},
+		},
+		{
+			name: "node replaced",
+			change: func(t *testing.T, cur *Snapshot) {
+				c := getSnapshotNode(t, cur, testID3)
+				c.ID, c.Addr = testNewID, "127.0.0.1:30005"
+			},
+			changes: []TopologyChange{
+				{Kind: ChangeAdded, NodeID: testNewID, Addr: "127.0.0.1:30005", Old: "-", New: "master"},
+				{Kind: ChangeRemoved, NodeID: testID3, Addr: "127.0.0.1:30003", Old: "master", New: "-"},
+			},
+			movements: []string{testID3 + "->" + testNewID + " 10923-16383"},
+		},
+		{
+			name: "addr and master id",
+			change: func(t *testing.T, cur *Snapshot) {
+				getSnapshotNode(t, cur, testID2).Addr = "127.0.0.1:30012"
+				getSnapshotNode(t, cur, testReplicaID).MasterID = testID2
+			},
+			changes: []TopologyChange{
+				{Kind: ChangeAddr, NodeID: testID2, Addr: "127.0.0.1:30012", Old: "127.0.0.1:30002", New: "127.0.0.1:30012"},
+				{Kind: ChangeMasterID, NodeID: testReplicaID, Addr: "127.0.0.1:30004", Old: testID1, New: testID2},
+			},
+		},
+		{
+			name: "slot not covered",
+			change: func(t *testing.T, cur *Snapshot) {
+				getSnapshotNode(t, cur, testID3).Slots = mustParseSlots(t, "10923-16382")
+			},
+			changes: []TopologyChange{
+				{Kind: ChangeSlots, NodeID: testID3, Addr: "127.0.0.1:30003", Old: "10923-16383", New: "10923-16382"},
+			},
+			movements: []string{testID3 + "-> 16383"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, cur := readTestSnapshot(t), readTestSnapshot(t)
+			tt.change(t, cur)
+
+			diff := DiffSnapshots(old, cur)
+			if !reflect.DeepEqual(diff.Changes, tt.changes) {
+				t.Errorf("DiffSnapshots changes =\n%+v\nwant\n%+v", diff.Changes, tt.changes)
+			}
+			if movements := formatMovements(diff.Movements); !reflect.DeepEqual(movements, tt.movements) {
+				t.Errorf("DiffSnapshots movements = %v, want %v", movements, tt.movements)
+			}
+			if empty := diff.IsEmpty(); empty != (len(tt.changes) == 0 && len(tt.movements) == 0) {
+				t.Errorf("DiffSnapshots IsEmpty = %v", empty)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package rh
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanRestore(t *testing.T) {
+	const (
+		a = testID1 + " 127.0.0.1:30001@31001 myself,master - 0 0 1 connected "
+		b = testID2 + " 127.0.0.1:30002@31002 master - 0 0 2 connected "
+		c = testID3 + " 127.0.0.1:30003@31003 master - 0 0 3 connected "
+		r = testReplicaID + " 127.0.0.1:30004@31004 slave " + testID1 + " 0 0 1 connected"
+	)
+
+	tests := []struct {
+		name  string
+		nodes []string
+		// moves are formatted as slot:src->dst
+		moves   []string
+		invalid bool
+	}{
+		{
+			name:  "no-op",
+			nodes: []string{a + "0-5460", b + "5461-10922", c + "10923-16383", r},
+		},
+		{
+			name:  "moved slot",
+			nodes: []string{a + "0-99 101-5460", b + "100 5461-10922", c + "10923-16383", r},
+			moves: []string{"100:" + testID2 + "->" + testID1},
+		},
+		{
+			name:  "moved slots from two masters",
+			nodes: []string{a + "0-5460 10923", b + "5461-10921", c + "10922 10924-16383", r},
+			moves: []string{
+				"10922:" + testID3 + "->" + testID2,
+				"10923:" + testID1 + "->" + testID3,
+			},
+		},
+		{
+			name: "node replaced at the same addr",
+			nodes: []string{a + "0-5460", b + "5461-10922 16383", r,
+				testNewID + " 127.0.0.1:30003@31003 master - 0 0 4 connected 10923-16382"},
+			moves: []string{"16383:" + testID2 + "->" + testNewID},
+		},
+		{
+			name: "node missing from the live cluster",
+			nodes: []string{a + "0-5460", b + "5461-10922", r,
+				testNewID + " 127.0.0.1:30005@31005 master - 0 0 4 connected 10923-16383"},
+			invalid: true,
+		},
+		{
+			name: "node no longer a master",
+			nodes: []string{b + "5461-10922", c + "10923-16383",
+				testID1 + " 127.0.0.1:30001@31001 slave " + testReplicaID + " 0 0 4 connected",
+				testReplicaID + " 127.0.0.1:30004@31004 master - 0 0 4 connected 0-5460"},
+			invalid: true,
+		},
+		{
+			name:    "slot not served",
+			nodes:   []string{a + "0-5460", b + "5461-10922", c + "10923-16382", r},
+			invalid: true,
+		},
+	}
+
+	snapshot := readTestSnapshot(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := ParseClusterNodes(strings.Join(tt.nodes, "\n"))
+			if err != nil {
+				t.Fatalf("ParseClusterNodes error: %s", err)
+			}
+
+			moves, err := PlanRestore(snapshot, nodes)
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("PlanRestore = %+v, want an error", moves)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PlanRestore error: %s", err)
+			}
+
+			var strs []string
+			for _, move := range moves {
+				strs = append(strs, fmt.Sprintf("%d:%s->%s", move.Slot, move.SrcNodeID, move.DstNodeID))
+			}
+			if !reflect.DeepEqual(strs, tt.moves) {
+				t.Errorf("PlanRestore moves = %v, want %v", strs, tt.moves)
+			}
+
+			// the restored cluster owns the slots of the snapshot
+			slots := applyMoves(t, nodes, moves)
+			for _, owner := range snapshot.Nodes {
+				node := getNodeByID(nodes, owner.ID)
+				if node == nil {
+					node = getNodeByAddr(nodes, owner.Addr)
+				}
+				if node != nil && !slots[node.ID].Equal(owner.Slots) {
+					t.Errorf("node %s owns %s after restore, want %s", node.ID, slots[node.ID], owner.Slots)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package rebalance
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	migrate_slots "github.com/geesugar/redis-tools/migrate-slots"
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/spf13/cobra"
+)
+
+const (
+	BySlots  = "slots"
+	ByMemory = "memory"
+)
+
+var (
+	addr       string
+	weights    []string
+	threshold  float64
+	by         string
+	sampleKeys int
+
+	options = migrate_slots.DefaultOptions()
+)
+
+func NewRebalanceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rebalance",
+		Short: "spread the slots, or their estimated memory, evenly across the masters, optionally weighted per node",
+		Run:   Run,
+	}
+
+	cmd.Flags().StringVarP(&addr, "addr", "", "", "redis addr")
+	cmd.Flags().StringSliceVarP(&weights, "weight", "", nil, "node_id=weight, masters not listed weigh 1, a weight of 0 empties the master")
+	cmd.Flags().Float64VarP(&threshold, "threshold", "", 2, "nothing moves if every master is within this percent of its expected slots count or bytes")
+	cmd.Flags().StringVarP(&by, "by", "", BySlots, "balance the slots count or the memory estimated by sampling the keys of every slot: slots or memory")
+	cmd.Flags().IntVarP(&sampleKeys, "sample-keys", "", 10, "keys of every slot sampled with MEMORY USAGE when balancing by memory")
+
+	options.AddFlags(cmd.Flags())
+	options.AddPlanFlags(cmd.Flags())
+
+	return cmd
+}
+
+func Run(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+
+	weightMap, err := ParseWeights(weights)
+	if err != nil {
+		log.Fatalf("parse weights error: %s", err)
+	}
+
+	nodes, err := rh.GetClusterNodes(ctx, addr, conn_options.Options)
+	if err != nil {
+		log.Fatalf("GetClusterNodes error: %s", err)
+	}
+
+	masterCliMap, err := migrate_slots.NewMasterClients(ctx, nodes)
+	if err != nil {
+		log.Fatalf("new master clients error: %s", err)
+	}
+	defer migrate_slots.CloseClients(masterCliMap)
+
+	var moves []rh.SlotMove
+	switch by {
+	case BySlots:
+		moves, err = rh.PlanRebalance(nodes, weightMap, threshold)
+	case ByMemory:
+		moves, err = PlanMemoryRebalance(ctx, masterCliMap, nodes, weightMap)
+	default:
+		log.Fatalf("unknown --by %s, expect %s or %s", by, BySlots, ByMemory)
+	}
+	if err != nil {
+		log.Fatalf("plan rebalance error: %s", err)
+	}
+
+	if len(moves) == 0 {
+		fmt.Printf("%s is balanced. threshold:%v%%\n", by, threshold)
+		return
+	}
+
+	if err := migrate_slots.CountPlanKeys(ctx, masterCliMap, moves); err != nil {
+		log.Fatalf("count plan keys error: %s", err)
+	}
+
+	migrate_slots.RunPlan(ctx, masterCliMap, rh.NewMigrationPlan(addr, nodes, moves), nil, options)
+}
+
+// PlanMemoryRebalance estimates the bytes of every slot and reads the maxmemory and used_memory
+// of every master, prints them, and plans the moves balancing the bytes
+func PlanMemoryRebalance(ctx context.Context, masterCliMap map[string]*rh.Client, nodes []*rh.ClusterNode, weightMap map[string]float64) ([]rh.SlotMove, error) {
+	slotBytes := make(map[int]int64, rh.TotalSlots)
+	maxMemory := make(map[string]int64)
+	usedMemory := make(map[string]int64)
+
+	for _, node := range nodes {
+		if !node.IsMaster() {
+			continue
+		}
+
+		cli, ok := masterCliMap[node.Addr]
+		if !ok {
+			return nil, fmt.Errorf("master addr not found. addr:%s", node.Addr)
+		}
+
+		estimates, err := cli.EstimateSlotsMemory(ctx, node.Slots, sampleKeys)
+		if err != nil {
+			return nil, err
+		}
+
+		var bytes int64
+		for slot, estimate := range estimates {
+			slotBytes[slot] = estimate
+			bytes += estimate
+		}
+
+		maxMemory[node.ID], err = cli.MaxMemory(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// the room of a master is left by its keys and its overhead, not the estimate of its keys
+		info, err := cli.GetInfo(ctx, "memory")
+		if err != nil {
+			return nil, err
+		}
+		if info.Memory.UsedMemory > 0 {
+			usedMemory[node.ID] = info.Memory.UsedMemory
+		}
+
+		fmt.Printf("node_id:%s addr:%s slots:%d estimated_bytes:%d used_memory:%d maxmemory:%d\n",
+			node.ID, node.Addr, node.Slots.SlotsCount(), bytes, usedMemory[node.ID], maxMemory[node.ID])
+	}
+
+	return rh.PlanMemoryRebalance(nodes, slotBytes, maxMemory, usedMemory, weightMap, threshold)
+}
+
+// ParseWeights parses node_id=weight pairs
+func ParseWeights(pairs []string) (map[string]float64, error) {
+	weightMap := make(map[string]float64, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid weight %s, expect node_id=weight", pair)
+		}
+
+		weight, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight %s: %s", pair, err)
+		}
+
+		weightMap[kv[0]] = weight
+	}
+
+	return weightMap, nil
+}
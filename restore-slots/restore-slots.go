@@ -0,0 +1,84 @@
+package restore_slots
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	migrate_slots "github.com/geesugar/redis-tools/migrate-slots"
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/spf13/cobra"
+)
+
+var (
+	addr    string
+	from    string
+	execute bool
+
+	options = migrate_slots.DefaultOptions()
+)
+
+func NewRestoreSlotsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore-slots",
+		Short: "migrate the slots back to the masters owning them in a snapshot",
+		Long: "compute the migrations bringing the slot ownership back to the one of a snapshot taken by the snapshot command, " +
+			"matching its masters by node ID or by addr. only the plan is printed unless --execute is set",
+		Run: Run,
+	}
+
+	cmd.Flags().StringVarP(&addr, "addr", "", "", "redis addr, defaults to the addr the snapshot was taken from")
+	cmd.Flags().StringVarP(&from, "from", "", "", "snapshot file to restore")
+	cmd.Flags().BoolVarP(&execute, "execute", "", false, "apply the migration plan, which is only printed by default")
+
+	options.AddFlags(cmd.Flags())
+	options.AddPlanFlags(cmd.Flags())
+	// the plan is a dry run unless --execute is set
+	_ = cmd.Flags().MarkHidden("dry-run")
+
+	return cmd
+}
+
+func Run(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+
+	// --dry-run is implied without --execute, together they would migrate for real
+	if execute && options.DryRun {
+		log.Fatalf("--dry-run can not be combined with --execute")
+	}
+
+	snapshot, err := rh.ReadSnapshot(from)
+	if err != nil {
+		log.Fatalf("read snapshot error: %s", err)
+	}
+
+	if addr == "" {
+		addr = snapshot.Addr
+	}
+
+	nodes, err := rh.GetClusterNodes(ctx, addr, conn_options.Options)
+	if err != nil {
+		log.Fatalf("GetClusterNodes error: %s", err)
+	}
+
+	moves, err := rh.PlanRestore(snapshot, nodes)
+	if err != nil {
+		log.Fatalf("plan restore error: %s", err)
+	}
+
+	fmt.Printf("addr:%s snapshot:%s created_at:%s moves:%d\n", addr, from, snapshot.CreatedAt, len(moves))
+
+	masterCliMap, err := migrate_slots.NewMasterClients(ctx, nodes)
+	if err != nil {
+		log.Fatalf("new master clients error: %s", err)
+	}
+	defer migrate_slots.CloseClients(masterCliMap)
+
+	if err := migrate_slots.CountPlanKeys(ctx, masterCliMap, moves); err != nil {
+		log.Fatalf("count plan keys error: %s", err)
+	}
+
+	options.DryRun = !execute
+	migrate_slots.RunPlan(ctx, masterCliMap, rh.NewMigrationPlan(addr, nodes, moves), nil, options)
+}
@@ -0,0 +1,158 @@
+package slot_tags
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatGo   = "go"
+	FormatJava = "java"
+)
+
+// javaMaxConstant is the class file limit of the UTF-8 length of a string constant
+const javaMaxConstant = 65535
+
+var (
+	seed    int64
+	length  int
+	format  string
+	pkgName string
+	name    string
+)
+
+func NewSlotTagsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "slot-tags",
+		Short: "print a hash tag for every slot, the same seed always gives the same table",
+		Run:   Run,
+	}
+
+	cmd.Flags().Int64VarP(&seed, "seed", "", 1, "seed of the generator")
+	cmd.Flags().IntVarP(&length, "length", "", 10, "length of the tags")
+	cmd.Flags().StringVarP(&format, "output", "o", FormatText, "output format: text, json, go or java")
+	cmd.Flags().StringVarP(&pkgName, "package", "", "", "package of the go or java source, go defaults to slottags")
+	cmd.Flags().StringVarP(&name, "name", "", "SlotTags", "name of the go variable or java class")
+
+	return cmd
+}
+
+func Run(cmd *cobra.Command, args []string) {
+	tags, err := rh.GenSlotTags(seed, length)
+	if err != nil {
+		log.Fatalf("generate slot tags error: %s", err)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	switch format {
+	case FormatText:
+		for slot, tag := range tags {
+			fmt.Fprintf(w, "slot-%d-{%s}\n", slot, tag)
+		}
+	case FormatJSON:
+		data, err := json.Marshal(tags)
+		if err != nil {
+			log.Fatalf("marshal slot tags error: %s", err)
+		}
+		fmt.Fprintln(w, string(data))
+	case FormatGo:
+		WriteGo(w, tags)
+	case FormatJava:
+		if err := WriteJava(w, tags); err != nil {
+			log.Fatalf("write java error: %s", err)
+		}
+	default:
+		log.Fatalf("unknown output format %s", format)
+	}
+
+	if err := w.Flush(); err != nil {
+		log.Fatalf("write slot tags error: %s", err)
+	}
+}
+
+func header() string {
+	return fmt.Sprintf("Code generated by redis-tools slot-tags --seed %d --length %d. DO NOT EDIT.", seed, length)
+}
+
+// WriteGo writes tags as a go array indexed by slot
+func WriteGo(w io.Writer, tags [rh.TotalSlots]string) {
+	pkg := pkgName
+	if pkg == "" {
+		pkg = "slottags"
+	}
+
+	fmt.Fprintf(w, "// %s\n\npackage %s\n\n", header(), pkg)
+	fmt.Fprintf(w, "// %s[slot] is a hash tag hashing to slot, use it as {tag} in keys.\n", name)
+	fmt.Fprintf(w, "var %s = [%d]string{\n", name, rh.TotalSlots)
+	for _, tag := range tags {
+		fmt.Fprintf(w, "\t%q,\n", tag)
+	}
+	fmt.Fprintf(w, "}\n")
+}
+
+// WriteJava writes tags as a java class holding an array indexed by slot.
+// An array initializer of 16384 strings exceeds the method size limit,
+// so the tags are joined into string constants split at load time.
+func WriteJava(w io.Writer, tags [rh.TotalSlots]string) error {
+	// the tags are ASCII letters, each one takes its length and a comma in a constant
+	chunkTags := javaMaxConstant / (len(tags[0]) + 1)
+	if chunkTags < 1 {
+		return fmt.Errorf("tag length %d exceeds the %d bytes of a java string constant", len(tags[0]), javaMaxConstant)
+	}
+
+	fmt.Fprintf(w, "// %s\n\n", header())
+	if pkgName != "" {
+		fmt.Fprintf(w, "package %s;\n\n", pkgName)
+	}
+
+	fmt.Fprintf(w, "public final class %s {\n", name)
+	fmt.Fprintf(w, "    /** TAGS[slot] is a hash tag hashing to slot, use it as {tag} in keys. */\n")
+	fmt.Fprintf(w, "    public static final String[] TAGS;\n\n")
+
+	chunks := 0
+	for i := 0; i < rh.TotalSlots; i += chunkTags {
+		end := i + chunkTags
+		if end > rh.TotalSlots {
+			end = rh.TotalSlots
+		}
+
+		fmt.Fprintf(w, "    private static final String CHUNK%d = \"", chunks)
+		for j, tag := range tags[i:end] {
+			if j > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprint(w, tag)
+		}
+		fmt.Fprintf(w, "\";\n")
+		chunks++
+	}
+
+	fmt.Fprintf(w, "\n    static {\n")
+	fmt.Fprintf(w, "        TAGS = new String[%d];\n", rh.TotalSlots)
+	fmt.Fprintf(w, "        String[] chunks = {")
+	for i := 0; i < chunks; i++ {
+		if i > 0 {
+			fmt.Fprint(w, ", ")
+		}
+		fmt.Fprintf(w, "CHUNK%d", i)
+	}
+	fmt.Fprintf(w, "};\n")
+	fmt.Fprintf(w, "        for (int i = 0; i < chunks.length; i++) {\n")
+	fmt.Fprintf(w, "            String[] chunk = chunks[i].split(\",\");\n")
+	fmt.Fprintf(w, "            System.arraycopy(chunk, 0, TAGS, i * %d, chunk.length);\n", chunkTags)
+	fmt.Fprintf(w, "        }\n")
+	fmt.Fprintf(w, "    }\n\n")
+	fmt.Fprintf(w, "    private %s() {\n    }\n", name)
+	fmt.Fprintf(w, "}\n")
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	"github.com/geesugar/redis-tools/output"
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/spf13/cobra"
+)
+
+// ExitChanged is the exit code when the topology changed between the snapshots, errors exit with 1
+const ExitChanged = 2
+
+var (
+	diffAddr string
+	format   string
+)
+
+func NewDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff <old snapshot> [new snapshot]",
+		Short: "compare the topology of two snapshots, or of a snapshot and the cluster of --addr",
+		Long: fmt.Sprintf("show the nodes added and removed, role changes, failovers, epoch bumps and slot movements between two snapshots, "+
+			"exit with %d when the topology changed", ExitChanged),
+		Args: cobra.RangeArgs(1, 2),
+		Run:  RunDiff,
+	}
+
+	cmd.Flags().StringVarP(&diffAddr, "addr", "", "", "redis addr, to compare the snapshot with the current topology when no new snapshot is given")
+	output.AddFlag(cmd.Flags(), &format)
+
+	return cmd
+}
+
+func RunDiff(cmd *cobra.Command, args []string) {
+	old, err := rh.ReadSnapshot(args[0])
+	if err != nil {
+		log.Fatalf("read snapshot error: %s", err)
+	}
+
+	var cur *rh.Snapshot
+	switch {
+	case len(args) == 2:
+		cur, err = rh.ReadSnapshot(args[1])
+		if err != nil {
+			log.Fatalf("read snapshot error: %s", err)
+		}
+	case diffAddr != "":
+		cur, err = rh.TakeSnapshot(context.Background(), diffAddr, conn_options.Options)
+		if err != nil {
+			log.Fatalf("take snapshot error: %s", err)
+		}
+	default:
+		log.Fatalf("new snapshot or --addr required")
+	}
+
+	diff := rh.DiffSnapshots(old, cur)
+	if err := output.Print(format, diff, func(w io.Writer) { printDiff(w, diff) }); err != nil {
+		log.Fatalf("print diff error: %s", err)
+	}
+
+	if !diff.IsEmpty() {
+		os.Exit(ExitChanged)
+	}
+}
+
+func printDiff(w io.Writer, diff *rh.SnapshotDiff) {
+	fmt.Fprintf(w, "from:%s to:%s changes:%d movements:%d\n", diff.From.Format(time.RFC3339), diff.To.Format(time.RFC3339),
+		len(diff.Changes), len(diff.Movements))
+
+	if len(diff.Changes) > 0 {
+		fmt.Fprintf(w, "CHANGE\tNODE_ID\tADDR\tOLD\tNEW\n")
+		for _, change := range diff.Changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", change.Kind, dash(change.NodeID), dash(change.Addr), dash(change.Old), dash(change.New))
+		}
+	}
+
+	if len(diff.Movements) > 0 {
+		fmt.Fprintf(w, "FROM\tFROM_ADDR\tTO\tTO_ADDR\tSLOTS\n")
+		for _, movement := range diff.Movements {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", dash(movement.From), dash(movement.FromAddr), dash(movement.To), dash(movement.ToAddr), movement.Slots)
+		}
+	}
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
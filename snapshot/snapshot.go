@@ -0,0 +1,91 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	conn_options "github.com/geesugar/redis-tools/conn-options"
+	rh "github.com/geesugar/redis-tools/pkg/redis-helper"
+	"github.com/spf13/cobra"
+)
+
+// FilePrefix starts the name of the snapshot files written to --dir, followed by the UTC time they were taken
+const FilePrefix = "snapshot-"
+
+var (
+	addr string
+	dir  string
+	file string
+	keep int
+)
+
+func NewSnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "save the CLUSTER NODES and CLUSTER INFO of every node to a timestamped JSON file",
+		Run:   Run,
+	}
+
+	cmd.Flags().StringVarP(&addr, "addr", "", "", "redis addr")
+	cmd.Flags().StringVarP(&dir, "dir", "", ".", "directory of the snapshot files, named "+FilePrefix+"<time>.json")
+	cmd.Flags().StringVarP(&file, "file", "f", "", "write the snapshot to this file instead, as YAML if the extension is .yaml or .yml")
+	cmd.Flags().IntVarP(&keep, "keep", "", 0, "remove the oldest snapshot files of --dir beyond this count, 0 keeps them all")
+
+	return cmd
+}
+
+func Run(cmd *cobra.Command, args []string) {
+	ctx := context.Background()
+
+	snapshot, err := rh.TakeSnapshot(ctx, addr, conn_options.Options)
+	if err != nil {
+		log.Fatalf("take snapshot error: %s", err)
+	}
+
+	path := file
+	if path == "" {
+		path = filepath.Join(dir, FilePrefix+snapshot.CreatedAt.UTC().Format("20060102T150405Z")+".json")
+	}
+
+	if err := rh.WriteSnapshot(path, snapshot); err != nil {
+		log.Fatalf("write snapshot error: %s", err)
+	}
+
+	unreachable := 0
+	for _, view := range snapshot.Views {
+		if view.Error != "" {
+			fmt.Printf("node:%s addr:%s not answered: %s\n", view.NodeID, view.Addr, view.Error)
+			unreachable++
+		}
+	}
+	fmt.Printf("snapshot of %d nodes written to %s, %d not answered\n", len(snapshot.Nodes), path, unreachable)
+
+	if file == "" && keep > 0 {
+		if err := removeOldSnapshots(dir, keep); err != nil {
+			log.Fatalf("remove old snapshots error: %s", err)
+		}
+	}
+}
+
+// removeOldSnapshots keeps the newest snapshot files of dir, their names sorting by time
+func removeOldSnapshots(dir string, keep int) error {
+	paths, err := filepath.Glob(filepath.Join(dir, FilePrefix+"*.json"))
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(paths)
+	for len(paths) > keep {
+		if err := os.Remove(paths[0]); err != nil {
+			return err
+		}
+		fmt.Printf("removed %s\n", paths[0])
+		paths = paths[1:]
+	}
+
+	return nil
+}